@@ -60,15 +60,40 @@ type Decl interface {
 // ----------------------------------------------------------------------------
 // Comments
 
-// A Comment node represents a single //-style or /*-style comment.
+// A Comment node represents a single #-style line comment or a
+// #[-style block comment ]#.
 type Comment struct {
-	Slash token.Pos // position of "/" starting the comment
-	Text  string    // comment text (excluding '\n' for //-style comments)
+	Slash token.Pos // position of "#" starting the comment
+	Text  string    // comment text (excluding '\n' for #-style comments)
 }
 
 func (c *Comment) Pos() token.Pos { return c.Slash }
 func (c *Comment) End() token.Pos { return token.Pos(int(c.Slash) + len(c.Text)) }
 
+// Directive returns the name of the directive to the Go tool chain the
+// comment c holds, or "". Directives are #-style line comments: build
+// constraints, named "go:build" or "+build" (for # +build lines), and
+// #go: directives such as #go:generate or #go:embed, named "go:generate"
+// and "go:embed".
+//
+func (c *Comment) Directive() string {
+	text := c.Text
+	if strings.HasPrefix(text, "# +build") {
+		text = "#" + text[2:]
+	}
+	if len(text) < 2 || text[0] != '#' || text[1] == '[' {
+		return ""
+	}
+	name := text[1:]
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name = name[:i]
+	}
+	if name == "+build" || strings.HasPrefix(name, "go:") && len(name) > len("go:") {
+		return name
+	}
+	return ""
+}
+
 // A CommentGroup represents a sequence of comments
 // with no other tokens and no empty lines between.
 //
@@ -109,6 +134,11 @@ func (g *CommentGroup) Text() string {
 		// Remove comment markers.
 		// The parser has given us exactly the comment text.
 		switch c[1] {
+		case '[':
+			// #[-style block comment ]#
+			if c[0] == '#' {
+				c = c[2 : len(c)-2]
+			}
 		case '/':
 			//-style comment (no newline at the end)
 			c = c[2:]
@@ -149,6 +179,37 @@ func (g *CommentGroup) Text() string {
 	return strings.Join(lines, "\n")
 }
 
+// ShiftEscapes adds n backslashes, where n is 1 or -1, to each run of
+// backslashes, possibly empty, between the bytes a and b in s, as in
+// "*\/" for "*/"; a backslash is only removed from a nonempty run.
+// Comment text never holds a next to b, so the printers escape the end
+// marker of the other comment syntax this way and undo it exactly.
+//
+func ShiftEscapes(s string, a, b byte, n int) string {
+	var buf []byte
+	for i := 0; i < len(s); i++ {
+		buf = append(buf, s[i])
+		if s[i] != a {
+			continue
+		}
+		j := i + 1
+		for j < len(s) && s[j] == '\\' {
+			j++
+		}
+		if j == len(s) || s[j] != b || n < 0 && j == i+1 {
+			continue
+		}
+		buf = append(buf, s[i+1:j]...)
+		if n > 0 {
+			buf = append(buf, '\\')
+		} else {
+			buf = buf[:len(buf)-1]
+		}
+		i = j - 1
+	}
+	return string(buf)
+}
+
 // ----------------------------------------------------------------------------
 // Expressions and types
 
@@ -224,6 +285,19 @@ func (f *FieldList) NumFields() int {
 	return n
 }
 
+// An Interpolation represents an expression interpolated in an
+// InterpolatedLit, with an optional format verb: #{x} or #{x:%verb}.
+//
+type Interpolation struct {
+	Lbrace token.Pos // position of "#{"
+	X      Expr      // interpolated expression
+	Verb   string    // format verb, e.g. "%5.2f"; or empty
+	Rbrace token.Pos // position of "}"
+}
+
+func (i *Interpolation) Pos() token.Pos { return i.Lbrace }
+func (i *Interpolation) End() token.Pos { return i.Rbrace + 1 }
+
 // An expression is represented by a tree consisting of one
 // or more of the following concrete expression nodes.
 //
@@ -258,6 +332,24 @@ type (
 		Value    string      // literal string; e.g. 42, 0x7f, 3.14, 1e-9, 2.4i, 'a', '\x7f', "foo" or `\m\n\o`
 	}
 
+	// An InterpolatedLit node represents a string literal with
+	// interpolated expressions, e.g. "user #{u.Name} has #{n} items".
+	// The text between the interpolations is found in Value.
+	//
+	InterpolatedLit struct {
+		ValuePos token.Pos        // literal position
+		Value    string           // literal string as found in the source
+		Exprs    []*Interpolation // interpolated expressions; or nil
+	}
+
+	// A MacroLit node represents a source macro, e.g. __line__, which
+	// stands for a literal depending on its position in the source.
+	//
+	MacroLit struct {
+		NamePos token.Pos // macro position
+		Name    string    // macro name, e.g. "__fname__"
+	}
+
 	// A FuncLit node represents a function literal.
 	FuncLit struct {
 		Type *FuncType  // function type
@@ -267,9 +359,30 @@ type (
 	// A CompositeLit node represents a composite literal.
 	CompositeLit struct {
 		Type   Expr      // literal type; or nil
-		Lbrace token.Pos // position of "{"
+		Lbrace token.Pos // position of "{" or INDENT
 		Elts   []Expr    // list of composite elements; or nil
-		Rbrace token.Pos // position of "}"
+		Rbrace token.Pos // position of "}" or DEDENT
+		Block  bool      // are the elements indented below the type ?
+	}
+
+	// A ComprehensionExpr node represents a list comprehension, e.g.
+	// [u.Name for u in users if u.Active], or a map comprehension,
+	// whose element is a *KeyValueExpr, e.g. {k: len(v) for k, v in m}.
+	// A typed comprehension is written like a composite literal, e.g.
+	// []string{u.Name for u in users}.
+	//
+	ComprehensionExpr struct {
+		Type   Expr      // slice or map type; or nil
+		Lbrack token.Pos // position of "[" or "{"
+		Elt    Expr      // element
+		For    token.Pos // position of "for"
+		Key    *Ident    // key variable; or nil
+		Value  *Ident    // value variable
+		In     token.Pos // position of "in"
+		X      Expr      // value to range over
+		If     token.Pos // position of "if", if any
+		Cond   Expr      // condition; or nil
+		Rbrack token.Pos // position of "]" or "}"
 	}
 
 	// A ParenExpr node represents a parenthesized expression.
@@ -293,6 +406,15 @@ type (
 		Rbrack token.Pos // position of "]"
 	}
 
+	// An IndexListExpr node represents an expression followed by multiple
+	// indices, as in the instantiation of a generic function or type.
+	IndexListExpr struct {
+		X       Expr      // expression
+		Lbrack  token.Pos // position of "["
+		Indices []Expr    // index expressions
+		Rbrack  token.Pos // position of "]"
+	}
+
 	// An SliceExpr node represents an expression followed by slice indices.
 	SliceExpr struct {
 		X      Expr      // expression
@@ -323,6 +445,29 @@ type (
 		Rparen   token.Pos // position of ")"
 	}
 
+	// A MacroExpr node represents the invocation of a macro declared
+	// by a MacroDecl, e.g. wrap!(f(x), "f"). An argument is an Expr,
+	// standing for an expression or a type, or a simple Stmt. The block
+	// following "do", if any, is passed as the last argument.
+	//
+	MacroExpr struct {
+		Name   *Ident     // macro name
+		Bang   token.Pos  // position of "!"
+		Lparen token.Pos  // position of "("
+		Args   []Node     // macro arguments; or nil
+		Rparen token.Pos  // position of ")"
+		Body   *BlockStmt // block following "do"; or nil
+	}
+
+	// A TryExpr node represents a call prefixed by "try", e.g.
+	// try ioutil.ReadFile(path). The trailing error result of the call
+	// is returned by the enclosing function if it is not nil.
+	//
+	TryExpr struct {
+		Try token.Pos // position of "try"
+		X   Expr      // call expression
+	}
+
 	// A StarExpr node represents an expression of the form "*" Expression.
 	// Semantically it could be a unary "*" expression, or a pointer type.
 	//
@@ -348,6 +493,18 @@ type (
 		Y     Expr        // right operand
 	}
 
+	// A CondExpr node represents a conditional expression, e.g.
+	// a if cond else b, whose value is a if cond holds and b
+	// otherwise.
+	//
+	CondExpr struct {
+		X    Expr      // value if Cond holds
+		If   token.Pos // position of "if"
+		Cond Expr      // condition
+		Else token.Pos // position of "else"
+		Y    Expr      // value otherwise
+	}
+
 	// A KeyValueExpr node represents (key : value) pairs
 	// in composite literals.
 	//
@@ -391,9 +548,10 @@ type (
 
 	// A FuncType node represents a function type.
 	FuncType struct {
-		Func    token.Pos  // position of "func" keyword (token.NoPos if there is no "func")
-		Params  *FieldList // (incoming) parameters; non-nil
-		Results *FieldList // (outgoing) results; or nil
+		Func       token.Pos  // position of "func" keyword (token.NoPos if there is no "func")
+		TypeParams *FieldList // type parameters; or nil
+		Params     *FieldList // (incoming) parameters; non-nil
+		Results    *FieldList // (outgoing) results; or nil
 	}
 
 	// An InterfaceType node represents an interface type.
@@ -421,11 +579,13 @@ type (
 
 // Pos and End implementations for expression/type nodes.
 //
-func (x *BadExpr) Pos() token.Pos  { return x.From }
-func (x *Ident) Pos() token.Pos    { return x.NamePos }
-func (x *Ellipsis) Pos() token.Pos { return x.Ellipsis }
-func (x *BasicLit) Pos() token.Pos { return x.ValuePos }
-func (x *FuncLit) Pos() token.Pos  { return x.Type.Pos() }
+func (x *BadExpr) Pos() token.Pos         { return x.From }
+func (x *Ident) Pos() token.Pos           { return x.NamePos }
+func (x *Ellipsis) Pos() token.Pos        { return x.Ellipsis }
+func (x *BasicLit) Pos() token.Pos        { return x.ValuePos }
+func (x *InterpolatedLit) Pos() token.Pos { return x.ValuePos }
+func (x *MacroLit) Pos() token.Pos        { return x.NamePos }
+func (x *FuncLit) Pos() token.Pos         { return x.Type.Pos() }
 func (x *CompositeLit) Pos() token.Pos {
 	if x.Type != nil {
 		return x.Type.Pos()
@@ -435,12 +595,16 @@ func (x *CompositeLit) Pos() token.Pos {
 func (x *ParenExpr) Pos() token.Pos      { return x.Lparen }
 func (x *SelectorExpr) Pos() token.Pos   { return x.X.Pos() }
 func (x *IndexExpr) Pos() token.Pos      { return x.X.Pos() }
+func (x *IndexListExpr) Pos() token.Pos  { return x.X.Pos() }
 func (x *SliceExpr) Pos() token.Pos      { return x.X.Pos() }
 func (x *TypeAssertExpr) Pos() token.Pos { return x.X.Pos() }
 func (x *CallExpr) Pos() token.Pos       { return x.Fun.Pos() }
+func (x *MacroExpr) Pos() token.Pos      { return x.Name.Pos() }
+func (x *TryExpr) Pos() token.Pos        { return x.Try }
 func (x *StarExpr) Pos() token.Pos       { return x.Star }
 func (x *UnaryExpr) Pos() token.Pos      { return x.OpPos }
 func (x *BinaryExpr) Pos() token.Pos     { return x.X.Pos() }
+func (x *CondExpr) Pos() token.Pos       { return x.X.Pos() }
 func (x *KeyValueExpr) Pos() token.Pos   { return x.Key.Pos() }
 func (x *ArrayType) Pos() token.Pos      { return x.Lbrack }
 func (x *StructType) Pos() token.Pos     { return x.Struct }
@@ -453,6 +617,12 @@ func (x *FuncType) Pos() token.Pos {
 func (x *InterfaceType) Pos() token.Pos { return x.Interface }
 func (x *MapType) Pos() token.Pos       { return x.Map }
 func (x *ChanType) Pos() token.Pos      { return x.Begin }
+func (x *ComprehensionExpr) Pos() token.Pos {
+	if x.Type != nil {
+		return x.Type.Pos()
+	}
+	return x.Lbrack
+}
 
 func (x *BadExpr) End() token.Pos { return x.To }
 func (x *Ident) End() token.Pos   { return token.Pos(int(x.NamePos) + len(x.Name)) }
@@ -462,21 +632,32 @@ func (x *Ellipsis) End() token.Pos {
 	}
 	return x.Ellipsis + 3 // len("...")
 }
-func (x *BasicLit) End() token.Pos       { return token.Pos(int(x.ValuePos) + len(x.Value)) }
-func (x *FuncLit) End() token.Pos        { return x.Body.End() }
-func (x *CompositeLit) End() token.Pos   { return x.Rbrace + 1 }
-func (x *ParenExpr) End() token.Pos      { return x.Rparen + 1 }
-func (x *SelectorExpr) End() token.Pos   { return x.Sel.End() }
-func (x *IndexExpr) End() token.Pos      { return x.Rbrack + 1 }
-func (x *SliceExpr) End() token.Pos      { return x.Rbrack + 1 }
-func (x *TypeAssertExpr) End() token.Pos { return x.Rparen + 1 }
-func (x *CallExpr) End() token.Pos       { return x.Rparen + 1 }
-func (x *StarExpr) End() token.Pos       { return x.X.End() }
-func (x *UnaryExpr) End() token.Pos      { return x.X.End() }
-func (x *BinaryExpr) End() token.Pos     { return x.Y.End() }
-func (x *KeyValueExpr) End() token.Pos   { return x.Value.End() }
-func (x *ArrayType) End() token.Pos      { return x.Elt.End() }
-func (x *StructType) End() token.Pos     { return x.Fields.End() }
+func (x *BasicLit) End() token.Pos        { return token.Pos(int(x.ValuePos) + len(x.Value)) }
+func (x *InterpolatedLit) End() token.Pos { return token.Pos(int(x.ValuePos) + len(x.Value)) }
+func (x *MacroLit) End() token.Pos        { return token.Pos(int(x.NamePos) + len(x.Name)) }
+func (x *FuncLit) End() token.Pos         { return x.Body.End() }
+func (x *CompositeLit) End() token.Pos    { return x.Rbrace + 1 }
+func (x *ParenExpr) End() token.Pos       { return x.Rparen + 1 }
+func (x *SelectorExpr) End() token.Pos    { return x.Sel.End() }
+func (x *IndexExpr) End() token.Pos       { return x.Rbrack + 1 }
+func (x *IndexListExpr) End() token.Pos   { return x.Rbrack + 1 }
+func (x *SliceExpr) End() token.Pos       { return x.Rbrack + 1 }
+func (x *TypeAssertExpr) End() token.Pos  { return x.Rparen + 1 }
+func (x *CallExpr) End() token.Pos        { return x.Rparen + 1 }
+func (x *TryExpr) End() token.Pos         { return x.X.End() }
+func (x *StarExpr) End() token.Pos        { return x.X.End() }
+func (x *UnaryExpr) End() token.Pos       { return x.X.End() }
+func (x *BinaryExpr) End() token.Pos      { return x.Y.End() }
+func (x *CondExpr) End() token.Pos        { return x.Y.End() }
+func (x *KeyValueExpr) End() token.Pos    { return x.Value.End() }
+func (x *ArrayType) End() token.Pos       { return x.Elt.End() }
+func (x *StructType) End() token.Pos      { return x.Fields.End() }
+func (x *MacroExpr) End() token.Pos {
+	if x.Body != nil {
+		return x.Body.End()
+	}
+	return x.Rparen + 1
+}
 func (x *FuncType) End() token.Pos {
 	if x.Results != nil {
 		return x.Results.End()
@@ -486,26 +667,37 @@ func (x *FuncType) End() token.Pos {
 func (x *InterfaceType) End() token.Pos { return x.Methods.End() }
 func (x *MapType) End() token.Pos       { return x.Value.End() }
 func (x *ChanType) End() token.Pos      { return x.Value.End() }
+func (x *ComprehensionExpr) End() token.Pos {
+	return x.Rbrack + 1
+}
 
 // exprNode() ensures that only expression/type nodes can be
 // assigned to an ExprNode.
 //
-func (*BadExpr) exprNode()        {}
-func (*Ident) exprNode()          {}
-func (*Ellipsis) exprNode()       {}
-func (*BasicLit) exprNode()       {}
-func (*FuncLit) exprNode()        {}
-func (*CompositeLit) exprNode()   {}
-func (*ParenExpr) exprNode()      {}
-func (*SelectorExpr) exprNode()   {}
-func (*IndexExpr) exprNode()      {}
-func (*SliceExpr) exprNode()      {}
-func (*TypeAssertExpr) exprNode() {}
-func (*CallExpr) exprNode()       {}
-func (*StarExpr) exprNode()       {}
-func (*UnaryExpr) exprNode()      {}
-func (*BinaryExpr) exprNode()     {}
-func (*KeyValueExpr) exprNode()   {}
+func (*BadExpr) exprNode()         {}
+func (*Ident) exprNode()           {}
+func (*Ellipsis) exprNode()        {}
+func (*BasicLit) exprNode()        {}
+func (*InterpolatedLit) exprNode() {}
+func (*MacroLit) exprNode()        {}
+func (*FuncLit) exprNode()         {}
+func (*CompositeLit) exprNode()    {}
+func (*ParenExpr) exprNode()       {}
+func (*SelectorExpr) exprNode()    {}
+func (*IndexExpr) exprNode()       {}
+func (*IndexListExpr) exprNode()   {}
+func (*SliceExpr) exprNode()       {}
+func (*TypeAssertExpr) exprNode()  {}
+func (*CallExpr) exprNode()        {}
+func (*MacroExpr) exprNode()       {}
+func (*TryExpr) exprNode()         {}
+func (*StarExpr) exprNode()        {}
+func (*UnaryExpr) exprNode()       {}
+func (*BinaryExpr) exprNode()      {}
+func (*CondExpr) exprNode()        {}
+func (*KeyValueExpr) exprNode()    {}
+
+func (*ComprehensionExpr) exprNode() {}
 
 func (*ArrayType) exprNode()     {}
 func (*StructType) exprNode()    {}
@@ -652,6 +844,17 @@ type (
 		Else Stmt // else branch; or nil
 	}
 
+	// A PostfixStmt node represents a statement followed by
+	// a modifier, as in "return err if err != nil" or
+	// "continue unless ok".
+	//
+	PostfixStmt struct {
+		Stmt   Stmt        // simple, go, defer, return or branch statement
+		TokPos token.Pos   // position of Tok
+		Tok    token.Token // IF or UNLESS
+		Cond   Expr        // condition
+	}
+
 	// A CaseClause represents a case of an expression or type switch statement.
 	CaseClause struct {
 		Case  token.Pos // position of "case" or "default" keyword
@@ -702,9 +905,9 @@ type (
 	// A RangeStmt represents a for statement with a range clause.
 	RangeStmt struct {
 		For        token.Pos   // position of "for" keyword
-		Key, Value Expr        // Value may be nil
-		TokPos     token.Pos   // position of Tok
-		Tok        token.Token // ASSIGN, DEFINE
+		Key, Value Expr        // Key, Value may be nil
+		TokPos     token.Pos   // position of Tok; invalid if Key == nil
+		Tok        token.Token // ILLEGAL if Key == nil, ASSIGN, DEFINE
 		X          Expr        // value to range over
 		Body       *BlockStmt
 	}
@@ -726,6 +929,7 @@ func (s *ReturnStmt) Pos() token.Pos     { return s.Return }
 func (s *BranchStmt) Pos() token.Pos     { return s.TokPos }
 func (s *BlockStmt) Pos() token.Pos      { return s.Opening }
 func (s *IfStmt) Pos() token.Pos         { return s.If }
+func (s *PostfixStmt) Pos() token.Pos    { return s.Stmt.Pos() }
 func (s *CaseClause) Pos() token.Pos     { return s.Case }
 func (s *SwitchStmt) Pos() token.Pos     { return s.Switch }
 func (s *TypeSwitchStmt) Pos() token.Pos { return s.Switch }
@@ -767,6 +971,7 @@ func (s *IfStmt) End() token.Pos {
 	}
 	return s.Body.End()
 }
+func (s *PostfixStmt) End() token.Pos { return s.Cond.End() }
 func (s *CaseClause) End() token.Pos {
 	if n := len(s.Body); n > 0 {
 		return s.Body[n-1].End()
@@ -802,6 +1007,7 @@ func (*ReturnStmt) stmtNode()     {}
 func (*BranchStmt) stmtNode()     {}
 func (*BlockStmt) stmtNode()      {}
 func (*IfStmt) stmtNode()         {}
+func (*PostfixStmt) stmtNode()    {}
 func (*CaseClause) stmtNode()     {}
 func (*SwitchStmt) stmtNode()     {}
 func (*TypeSwitchStmt) stmtNode() {}
@@ -817,7 +1023,8 @@ func (*RangeStmt) stmtNode()      {}
 // constant, type, or variable declaration.
 //
 type (
-	// The Spec type stands for any of *ImportSpec, *ValueSpec, and *TypeSpec.
+	// The Spec type stands for any of *ImportSpec, *ValueSpec, *TypeSpec,
+	// and *ImplementsSpec.
 	Spec interface {
 		Node
 		specNode()
@@ -825,11 +1032,12 @@ type (
 
 	// An ImportSpec node represents a single package import.
 	ImportSpec struct {
-		Doc     *CommentGroup // associated documentation; or nil
-		Name    *Ident        // local package name (including "."); or nil
-		Path    *BasicLit     // import path
-		Comment *CommentGroup // line comments; or nil
-		EndPos  token.Pos     // end of spec (overrides Path.Pos if nonzero)
+		Doc      *CommentGroup // associated documentation; or nil
+		Name     *Ident        // local package name (including "."); or nil
+		Path     *BasicLit     // import path
+		Comment  *CommentGroup // line comments; or nil
+		EndPos   token.Pos     // end of spec (overrides Path.Pos if nonzero)
+		Preamble *CommentGroup // cgo preamble of import "C"; or nil
 	}
 
 	// A ValueSpec node represents a constant or variable declaration
@@ -841,14 +1049,28 @@ type (
 		Type    Expr          // value type; or nil
 		Values  []Expr        // initial values; or nil
 		Comment *CommentGroup // line comments; or nil
+		Embed   []*Comment    // #go:embed directives; or nil
 	}
 
 	// A TypeSpec node represents a type declaration (TypeSpec production).
 	TypeSpec struct {
-		Doc     *CommentGroup // associated documentation; or nil
-		Name    *Ident        // type name
-		Type    Expr          // *Ident, *ParenExpr, *SelectorExpr, *StarExpr, or any of the *XxxTypes
-		Comment *CommentGroup // line comments; or nil
+		Doc        *CommentGroup // associated documentation; or nil
+		Name       *Ident        // type name
+		TypeParams *FieldList    // type parameters; or nil
+		Assign     token.Pos     // position of '=', if any
+		Type       Expr          // *Ident, *ParenExpr, *SelectorExpr, *StarExpr, or any of the *XxxTypes
+		Comment    *CommentGroup // line comments; or nil
+	}
+
+	// An ImplementsSpec node represents the declaration that a type
+	// implements a list of interfaces.
+	//
+	ImplementsSpec struct {
+		Doc        *CommentGroup // associated documentation; or nil
+		Name       *Ident        // type name
+		Implements token.Pos     // position of "implements" keyword
+		Types      []Expr        // interface types (len(Types) > 0)
+		Comment    *CommentGroup // line comments; or nil
 	}
 )
 
@@ -862,6 +1084,9 @@ func (s *ImportSpec) Pos() token.Pos {
 }
 func (s *ValueSpec) Pos() token.Pos { return s.Names[0].Pos() }
 func (s *TypeSpec) Pos() token.Pos  { return s.Name.Pos() }
+func (s *ImplementsSpec) Pos() token.Pos {
+	return s.Name.Pos()
+}
 
 func (s *ImportSpec) End() token.Pos {
 	if s.EndPos != 0 {
@@ -880,13 +1105,17 @@ func (s *ValueSpec) End() token.Pos {
 	return s.Names[len(s.Names)-1].End()
 }
 func (s *TypeSpec) End() token.Pos { return s.Type.End() }
+func (s *ImplementsSpec) End() token.Pos {
+	return s.Types[len(s.Types)-1].End()
+}
 
 // specNode() ensures that only spec nodes can be
 // assigned to a Spec.
 //
-func (*ImportSpec) specNode() {}
-func (*ValueSpec) specNode()  {}
-func (*TypeSpec) specNode()   {}
+func (*ImportSpec) specNode()     {}
+func (*ValueSpec) specNode()      {}
+func (*TypeSpec) specNode()       {}
+func (*ImplementsSpec) specNode() {}
 
 // A declaration is represented by one of the following declaration nodes.
 //
@@ -907,7 +1136,7 @@ type (
 	//
 	//	token.IMPORT  *ImportSpec
 	//	token.CONST   *ValueSpec
-	//	token.TYPE    *TypeSpec
+	//	token.TYPE    *TypeSpec or *ImplementsSpec
 	//	token.VAR     *ValueSpec
 	//
 	GenDecl struct {
@@ -927,13 +1156,65 @@ type (
 		Type *FuncType     // function signature: parameters, results, and position of "func" keyword
 		Body *BlockStmt    // function body; or nil (forward declaration)
 	}
+
+	// A MacroDecl node represents a macro declaration. The kind of a
+	// parameter, expr, stmt or type, is the *Ident in its Type field.
+	// Identifiers declared in Body are renamed at each expansion.
+	//
+	MacroDecl struct {
+		Doc    *CommentGroup // associated documentation; or nil
+		Macro  token.Pos     // position of "macro" keyword
+		Name   *Ident        // macro name
+		Params *FieldList    // macro parameters
+		Body   *BlockStmt    // macro body
+	}
+
+	// A MethodsDecl node represents a methods block, whose functions are
+	// methods with its receiver. Each of them has its own copy of Recv.
+	//
+	MethodsDecl struct {
+		Doc     *CommentGroup // associated documentation; or nil
+		Methods token.Pos     // position of "methods" keyword
+		Recv    *FieldList    // receiver of the methods
+		Indent  token.Pos     // position of INDENT
+		List    []*FuncDecl
+		Dedent  token.Pos // position of DEDENT
+	}
+
+	// An EnumDecl node represents an enum declaration. Its members are
+	// constants of the enum type, each with a single name and at most
+	// one value.
+	//
+	EnumDecl struct {
+		Doc     *CommentGroup // associated documentation; or nil
+		Enum    token.Pos     // position of "enum" keyword
+		Name    *Ident        // enum name
+		Type    Expr          // underlying integer type; or nil
+		Indent  token.Pos     // position of INDENT
+		Members []*ValueSpec
+		Dedent  token.Pos // position of DEDENT
+	}
+
+	// A VerbatimDecl node represents a go! region: lines of Go source,
+	// which are not parsed but printed as they are, without the
+	// indentation of the first one.
+	//
+	VerbatimDecl struct {
+		Doc  *CommentGroup // associated documentation; or nil
+		Go   token.Pos     // position of "go!"
+		Text string        // region source, from "go!" up to its last non-blank line
+	}
 )
 
 // Pos and End implementations for declaration nodes.
 //
-func (d *BadDecl) Pos() token.Pos  { return d.From }
-func (d *GenDecl) Pos() token.Pos  { return d.TokPos }
-func (d *FuncDecl) Pos() token.Pos { return d.Type.Pos() }
+func (d *BadDecl) Pos() token.Pos      { return d.From }
+func (d *GenDecl) Pos() token.Pos      { return d.TokPos }
+func (d *FuncDecl) Pos() token.Pos     { return d.Type.Pos() }
+func (d *MacroDecl) Pos() token.Pos    { return d.Macro }
+func (d *EnumDecl) Pos() token.Pos     { return d.Enum }
+func (d *MethodsDecl) Pos() token.Pos  { return d.Methods }
+func (d *VerbatimDecl) Pos() token.Pos { return d.Go }
 
 func (d *BadDecl) End() token.Pos { return d.To }
 func (d *GenDecl) End() token.Pos {
@@ -948,13 +1229,21 @@ func (d *FuncDecl) End() token.Pos {
 	}
 	return d.Type.End()
 }
+func (d *MacroDecl) End() token.Pos    { return d.Body.End() }
+func (d *EnumDecl) End() token.Pos     { return d.Dedent + 1 }
+func (d *MethodsDecl) End() token.Pos  { return d.Dedent + 1 }
+func (d *VerbatimDecl) End() token.Pos { return d.Go + token.Pos(len(d.Text)) }
 
 // declNode() ensures that only declaration nodes can be
 // assigned to a DeclNode.
 //
-func (*BadDecl) declNode()  {}
-func (*GenDecl) declNode()  {}
-func (*FuncDecl) declNode() {}
+func (*BadDecl) declNode()      {}
+func (*GenDecl) declNode()      {}
+func (*FuncDecl) declNode()     {}
+func (*MacroDecl) declNode()    {}
+func (*EnumDecl) declNode()     {}
+func (*MethodsDecl) declNode()  {}
+func (*VerbatimDecl) declNode() {}
 
 // ----------------------------------------------------------------------------
 // Files and packages
@@ -963,7 +1252,8 @@ func (*FuncDecl) declNode() {}
 //
 // The Comments list contains all comments in the source file in order of
 // appearance, including the comments that are pointed to from other nodes
-// via Doc and Comment fields.
+// via Doc and Comment fields, and the directives attached to the nodes
+// they apply to via Build, Generate, Embed and Preamble fields.
 //
 type File struct {
 	Doc        *CommentGroup   // associated documentation; or nil
@@ -974,6 +1264,8 @@ type File struct {
 	Imports    []*ImportSpec   // imports in this file
 	Unresolved []*Ident        // unresolved identifiers in this file
 	Comments   []*CommentGroup // list of all comments in the source file
+	Build      []*Comment      // build constraints; or nil
+	Generate   []*Comment      // #go:generate directives; or nil
 }
 
 func (f *File) Pos() token.Pos { return f.Package }
@@ -84,8 +84,11 @@ func Walk(v Visitor, node Node) {
 			Walk(v, f)
 		}
 
+	case *Interpolation:
+		Walk(v, n.X)
+
 	// Expressions
-	case *BadExpr, *Ident, *BasicLit:
+	case *BadExpr, *Ident, *BasicLit, *MacroLit:
 		// nothing to do
 
 	case *Ellipsis:
@@ -93,6 +96,11 @@ func Walk(v Visitor, node Node) {
 			Walk(v, n.Elt)
 		}
 
+	case *InterpolatedLit:
+		for _, x := range n.Exprs {
+			Walk(v, x)
+		}
+
 	case *FuncLit:
 		Walk(v, n.Type)
 		Walk(v, n.Body)
@@ -103,6 +111,20 @@ func Walk(v Visitor, node Node) {
 		}
 		walkExprList(v, n.Elts)
 
+	case *ComprehensionExpr:
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+		Walk(v, n.Elt)
+		if n.Key != nil {
+			Walk(v, n.Key)
+		}
+		Walk(v, n.Value)
+		Walk(v, n.X)
+		if n.Cond != nil {
+			Walk(v, n.Cond)
+		}
+
 	case *ParenExpr:
 		Walk(v, n.X)
 
@@ -114,6 +136,10 @@ func Walk(v Visitor, node Node) {
 		Walk(v, n.X)
 		Walk(v, n.Index)
 
+	case *IndexListExpr:
+		Walk(v, n.X)
+		walkExprList(v, n.Indices)
+
 	case *SliceExpr:
 		Walk(v, n.X)
 		if n.Low != nil {
@@ -136,6 +162,18 @@ func Walk(v Visitor, node Node) {
 		Walk(v, n.Fun)
 		walkExprList(v, n.Args)
 
+	case *MacroExpr:
+		Walk(v, n.Name)
+		for _, x := range n.Args {
+			Walk(v, x)
+		}
+		if n.Body != nil {
+			Walk(v, n.Body)
+		}
+
+	case *TryExpr:
+		Walk(v, n.X)
+
 	case *StarExpr:
 		Walk(v, n.X)
 
@@ -146,6 +184,11 @@ func Walk(v Visitor, node Node) {
 		Walk(v, n.X)
 		Walk(v, n.Y)
 
+	case *CondExpr:
+		Walk(v, n.X)
+		Walk(v, n.Cond)
+		Walk(v, n.Y)
+
 	case *KeyValueExpr:
 		Walk(v, n.Key)
 		Walk(v, n.Value)
@@ -161,6 +204,9 @@ func Walk(v Visitor, node Node) {
 		Walk(v, n.Fields)
 
 	case *FuncType:
+		if n.TypeParams != nil {
+			Walk(v, n.TypeParams)
+		}
 		if n.Params != nil {
 			Walk(v, n.Params)
 		}
@@ -233,6 +279,10 @@ func Walk(v Visitor, node Node) {
 			Walk(v, n.Else)
 		}
 
+	case *PostfixStmt:
+		Walk(v, n.Stmt)
+		Walk(v, n.Cond)
+
 	case *CaseClause:
 		walkExprList(v, n.List)
 		walkStmtList(v, n.Body)
@@ -275,7 +325,9 @@ func Walk(v Visitor, node Node) {
 		Walk(v, n.Body)
 
 	case *RangeStmt:
-		Walk(v, n.Key)
+		if n.Key != nil {
+			Walk(v, n.Key)
+		}
 		if n.Value != nil {
 			Walk(v, n.Value)
 		}
@@ -313,11 +365,24 @@ func Walk(v Visitor, node Node) {
 			Walk(v, n.Doc)
 		}
 		Walk(v, n.Name)
+		if n.TypeParams != nil {
+			Walk(v, n.TypeParams)
+		}
 		Walk(v, n.Type)
 		if n.Comment != nil {
 			Walk(v, n.Comment)
 		}
 
+	case *ImplementsSpec:
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
+		Walk(v, n.Name)
+		walkExprList(v, n.Types)
+		if n.Comment != nil {
+			Walk(v, n.Comment)
+		}
+
 	case *BadDecl:
 		// nothing to do
 
@@ -342,6 +407,40 @@ func Walk(v Visitor, node Node) {
 			Walk(v, n.Body)
 		}
 
+	case *MacroDecl:
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
+		Walk(v, n.Name)
+		Walk(v, n.Params)
+		Walk(v, n.Body)
+
+	case *MethodsDecl:
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
+		Walk(v, n.Recv)
+		for _, f := range n.List {
+			Walk(v, f)
+		}
+
+	case *EnumDecl:
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
+		Walk(v, n.Name)
+		if n.Type != nil {
+			Walk(v, n.Type)
+		}
+		for _, m := range n.Members {
+			Walk(v, m)
+		}
+
+	case *VerbatimDecl:
+		if n.Doc != nil {
+			Walk(v, n.Doc)
+		}
+
 	// Files and packages
 	case *File:
 		if n.Doc != nil {
@@ -41,6 +41,12 @@ func goInitPrinterMode() {
 	if *tabIndent {
 		goPrinterMode |= printer.TabIndent
 	}
+	if *postfix {
+		goPrinterMode |= printer.PostfixIf
+	}
+	if *methods {
+		goPrinterMode |= printer.Methods
+	}
 }
 
 func goProcessFile(filename string, in io.Reader, out io.Writer) error {
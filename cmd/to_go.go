@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"fmt"
 	"path/filepath"
 
 	printer "github.com/DAddYE/igo/to_go"
@@ -14,6 +15,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 )
 
@@ -22,6 +24,8 @@ var (
 	igoFileSet     = token.NewFileSet() // per process FileSet
 	igoParserMode  parser.Mode
 	igoPrinterMode printer.Mode
+	igoScript      bool                                       // script mode: files without package clause are main packages
+	igoPackages    = make(map[string]map[string]*ast.Package) // parsed packages by directory
 )
 
 func igoReport(err error) {
@@ -29,7 +33,7 @@ func igoReport(err error) {
 	exitCode = 2
 }
 
-func igoInit() {
+func igoInit(script bool) {
 	igoParserMode = parser.Mode(0)
 	if *comments {
 		igoParserMode |= parser.ParseComments
@@ -39,6 +43,10 @@ func igoInit() {
 	if *tabIndent {
 		igoPrinterMode |= printer.TabIndent
 	}
+	igoScript = script
+	if script {
+		igoPrinterMode |= printer.ImportStd
+	}
 }
 
 func igoProcessFile(filename string, in io.Reader, out io.Writer) error {
@@ -64,7 +72,8 @@ func igoProcessFile(filename string, in io.Reader, out io.Writer) error {
 
 	var buf bytes.Buffer
 	var pos *printer.Positions
-	pos, err = (&printer.Config{Mode: igoPrinterMode, Tabwidth: *tabWidth}).Fprint(&buf, igoFileSet, file)
+	cfg := &printer.Config{Mode: igoPrinterMode, Tabwidth: *tabWidth, PkgFiles: igoPackageFiles(filename, file)}
+	pos, err = cfg.Fprint(&buf, igoFileSet, file)
 	if err != nil {
 		return err
 	}
@@ -86,12 +95,81 @@ func igoProcessFile(filename string, in io.Reader, out io.Writer) error {
 	return err
 }
 
+// igoPackageFiles returns the other files in the package of file (read
+// from filename), which may declare the macros that file invokes or the
+// functions it calls with try. It returns nil if file uses neither.
+//
+func igoPackageFiles(filename string, file *ast.File) []*ast.File {
+	uses := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.MacroExpr, *ast.TryExpr:
+			uses = true
+		}
+		return !uses
+	})
+	if !uses {
+		return nil
+	}
+
+	dir := filepath.Dir(filename)
+	pkgs, found := igoPackages[dir]
+	if !found {
+		// errors are reported when compiling the other files
+		pkgs = igoParseDir(dir)
+		igoPackages[dir] = pkgs
+	}
+	pkg := pkgs[file.Name.Name]
+	if pkg == nil {
+		return nil
+	}
+
+	var names []string
+	for name := range pkg.Files {
+		if filepath.Base(name) != filepath.Base(filename) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	files := make([]*ast.File, len(names))
+	for i, name := range names {
+		files[i] = pkg.Files[name]
+	}
+	return files
+}
+
 func igoFile(f os.FileInfo) bool {
 	// ignore non-iGo files
 	name := f.Name()
 	return !f.IsDir() && !strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".igo")
 }
 
+// igoParseDir parses the iGo files in dir, returning a map of package
+// name -> package AST with all the packages found. Files which do not
+// parse are left out.
+//
+func igoParseDir(dir string) map[string]*ast.Package {
+	list, _ := ioutil.ReadDir(dir)
+	pkgs := make(map[string]*ast.Package)
+	for _, f := range list {
+		if !igoFile(f) {
+			continue
+		}
+		filename := filepath.Join(dir, f.Name())
+		src, err := parser.ParseFile(igoFileSet, filename, nil, igoParserMode)
+		if err != nil {
+			continue
+		}
+		pkg, found := pkgs[src.Name.Name]
+		if !found {
+			pkg = &ast.Package{Name: src.Name.Name, Files: make(map[string]*ast.File)}
+			pkgs[src.Name.Name] = pkg
+		}
+		pkg.Files[filename] = src
+	}
+	return pkgs
+}
+
 func igoVisitFile(path string, f os.FileInfo, err error) error {
 	if err == nil && igoFile(f) {
 		err = igoProcessFile(path, nil, os.Stdout)
@@ -117,11 +195,16 @@ func igoWalkPath(path string) {
 }
 
 // parse parses src, which was read from filename,
-// as a Go source file or statement list.
+// as an iGo source file or statement list. In script
+// mode, a declaration or statement list is made a main
+// package instead of a fragment.
 func igoParse(fset *token.FileSet, filename string, src []byte) (*ast.File, func(orig, src []byte) []byte, error) {
 	// Try as whole source file.
 	file, err := parser.ParseFile(fset, filename, src, igoParserMode)
 	if err == nil {
+		if igoScript {
+			dropShebang(fset, file)
+		}
 		return file, nil, nil
 	}
 	// If the error is that the source file didn't begin with a
@@ -135,9 +218,17 @@ func igoParse(fset *token.FileSet, filename string, src []byte) (*ast.File, func
 	// by inserting a package clause.
 	// Insert using a ;, not a newline, so that the line numbers
 	// in psrc match the ones in src.
-	psrc := append([]byte("package p;"), src...)
+	pkg := "package p;"
+	if igoScript {
+		pkg = "package main;"
+	}
+	psrc := append([]byte(pkg), src...)
 	file, err = parser.ParseFile(fset, filename, psrc, igoParserMode)
 	if err == nil {
+		if igoScript {
+			dropShebang(fset, file)
+			return file, nil, nil
+		}
 		adjust := func(orig, src []byte) []byte {
 			// Remove the package clause.
 			// Gofmt has turned the ; into a \n.
@@ -153,6 +244,79 @@ func igoParse(fset *token.FileSet, filename string, src []byte) (*ast.File, func
 		return nil, nil, err
 	}
 
+	// If this is a statement list, make it a source file
+	// by inserting a package clause and turning the list
+	// into a function body.  This handles expressions too.
+	// The body must be indented, so the wrapping takes
+	// lines of its own: #line comments number them after
+	// the lines of src, and restore the numbers of these.
+	base := filepath.Base(filename)
+	fun := "func _()"
+	if igoScript {
+		fun = "func main()"
+	}
+	wrap := fmt.Sprintf("#line %s:%d\n%s\n\n%s\n#line %s:1\n", base, bytes.Count(src, []byte{'\n'})+2, strings.TrimSuffix(pkg, ";"), fun, base)
+	fsrc := []byte(wrap)
+	for _, line := range bytes.SplitAfter(src, []byte{'\n'}) {
+		if len(line) > 0 {
+			fsrc = append(append(fsrc, '\t'), line...)
+		}
+	}
+	file, err = parser.ParseFile(fset, filename, fsrc, igoParserMode)
+	if err == nil {
+		// Drop the #line comments.
+		file.Doc = nil
+		var comments []*ast.CommentGroup
+		for _, g := range file.Comments {
+			for len(g.List) > 0 && fset.Position(g.List[0].Pos()).Offset < len(wrap) {
+				g.List = g.List[1:]
+			}
+			if len(g.List) > 0 {
+				comments = append(comments, g)
+			}
+		}
+		file.Comments = comments
+		// Open the body on the first line of src, as
+		// in the Go wrapping.
+		body := file.Decls[len(file.Decls)-1].(*ast.FuncDecl).Body
+		body.Opening = fset.File(file.Pos()).Pos(len(wrap))
+		if igoScript {
+			dropShebang(fset, file)
+			return file, nil, nil
+		}
+		adjust := func(orig, src []byte) []byte {
+			// Remove the wrapping, and the imports
+			// needed by the statements, if any.
+			src = src[bytes.Index(src, []byte(fun+" {"))+len(fun+" {"):]
+			src = src[:len(src)-len("}\n")]
+			// The function body is indented one level.
+			// Remove that indent.
+			src = bytes.Replace(src, []byte("\n\t"), []byte("\n"), -1)
+			return matchSpace(orig, src)
+		}
+		return file, adjust, nil
+	}
+
 	// Failed, and out of options.
 	return nil, nil, err
 }
+
+// dropShebang removes from the comments of the script file the #! line
+// starting it, which Go has no place for.
+//
+func dropShebang(fset *token.FileSet, file *ast.File) {
+	if len(file.Comments) == 0 {
+		return
+	}
+	g := file.Comments[0]
+	if c := g.List[0]; !strings.HasPrefix(c.Text, "#!") || fset.Position(c.Pos()).Line != 1 {
+		return
+	}
+	g.List = g.List[1:]
+	if len(g.List) == 0 {
+		file.Comments = file.Comments[1:]
+		if file.Doc == g {
+			file.Doc = nil
+		}
+	}
+}
@@ -13,6 +13,7 @@ type Mode int
 const (
 	GO Mode = iota
 	IGO
+	SCRIPT
 )
 
 var (
@@ -20,6 +21,8 @@ var (
 	comments  = flag.Bool("comments", true, "print comments")
 	tabWidth  = flag.Int("tabwidth", 8, "tab width")
 	tabIndent = flag.Bool("tabs", true, "indent with tabs")
+	postfix   = flag.Bool("postfix", false, "print single-statement ifs as postfix conditionals")
+	methods   = flag.Bool("methods", false, "group consecutive methods with the same receiver in methods blocks")
 	DestDir   = flag.String("dest", "./", "destination directory")
 
 	// ExitCode
@@ -38,7 +41,7 @@ func To(m Mode, paths []string) int {
 		goInitParserMode()
 		goInitPrinterMode()
 	} else {
-		igoInit()
+		igoInit(m == SCRIPT)
 	}
 
 	// If we don't want to process a single file or directory,
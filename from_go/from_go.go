@@ -16,6 +16,8 @@ import (
 	"text/tabwriter"
 	"unicode"
 
+	iAst "github.com/DAddYE/igo/ast"
+	iParser "github.com/DAddYE/igo/parser"
 	iToken "github.com/DAddYE/igo/token"
 )
 
@@ -89,6 +91,26 @@ type printer struct {
 
 	// Set the function scope to allow identifier change
 	rcvName *ast.Ident // the name of the receiver
+
+	// Set when printing the methods of a methods block, whose receiver
+	// is printed once in the block header
+	inMethods bool
+
+	// The call ending the current statement, whose final function
+	// literal argument is printed as a trailing do block; or nil
+	doCall *ast.CallExpr
+
+	// The composite literal ending the current statement, declaration
+	// or element, printed with its elements indented below its type if
+	// it spans several lines; or nil
+	blockLit *ast.CompositeLit
+
+	// The if statement following the current "else", which is never
+	// printed with a statement modifier; or nil
+	elseIf *ast.IfStmt
+
+	// The variables of the loops around the statement being printed
+	loops []*ast.Object
 }
 
 func (p *printer) init(cfg *Config, fset *token.FileSet, nodeSizes map[ast.Node]int) {
@@ -354,7 +376,7 @@ func (p *printer) writeCommentPrefix(pos, next token.Position, prev, comment *as
 				// as it is (likely) belonging to the last
 				// construct (e.g., a multi-line expression list)
 				// and is not part of closing a block
-				if i+1 < len(p.wsbuf) && p.wsbuf[i+1] == unindent {
+				if unindentFollows(p.wsbuf[i+1:]) {
 					continue
 				}
 				// if the next token is not a closing }, apply the unindent
@@ -369,6 +391,11 @@ func (p *printer) writeCommentPrefix(pos, next token.Position, prev, comment *as
 			case newline, formfeed:
 				p.wsbuf[i] = ignore
 				droppedLinebreak = prev == nil // record only if first comment of a group
+				if unindentFollows(p.wsbuf[i+1:]) {
+					// without closing braces, the line breaks of
+					// nested blocks separate their unindents
+					continue
+				}
 			}
 			j = i
 			break
@@ -407,6 +434,21 @@ func (p *printer) writeCommentPrefix(pos, next token.Position, prev, comment *as
 	}
 }
 
+// unindentFollows reports whether the whitespace ws starts with an
+// unindent, possibly after line breaks.
+func unindentFollows(ws []whiteSpace) bool {
+	for _, ch := range ws {
+		switch ch {
+		case unindent:
+			return true
+		case newline, formfeed, ignore:
+			continue
+		}
+		return false
+	}
+	return false
+}
+
 // Returns true if s contains only white space
 // (only tabs and blanks can appear in the printer's context).
 //
@@ -424,41 +466,61 @@ func trimRight(s string) string {
 	return strings.TrimRightFunc(s, unicode.IsSpace)
 }
 
-func trimSuffix(s string) string {
-	return strings.TrimRightFunc(s, func(r rune) bool {
-		switch r {
-		case '*', '/':
-			return true
-		default:
-			return false
-		}
-	})
+// commonPrefix returns the common white space prefix of a and b.
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] && (a[i] <= ' ') {
+		i++
+	}
+	return a[0:i]
 }
 
-func trimPrefix(s string) string {
-	return strings.TrimLeftFunc(s, func(r rune) bool {
-		switch r {
-		case '/', '*':
-			return true
-		default:
-			return false
+// unindentLines removes from all but the first line of a block comment
+// the white space prefix common to the non-blank ones, ignoring a last
+// line holding only the closing marker, but no more than the first
+// column bytes, the indentation of the line the comment starts on. The
+// lines keep their indentation relative to that line, and the printer
+// adds back its own when writing them.
+//
+func unindentLines(lines []string, column int) {
+	last := len(lines) - 1
+	if last > 0 && strings.TrimSpace(lines[last]) == "]#" {
+		lines[last] = "]#"
+	}
+	prefix, first := "", true
+	for _, line := range lines[1:] {
+		if isBlank(line) || line == "]#" {
+			continue
+		}
+		ws := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix, first = ws, false
+		} else {
+			prefix = commonPrefix(prefix, ws)
 		}
-	})
+	}
+	if column >= 0 && len(prefix) > column {
+		prefix = prefix[:column]
+	}
+	for i, line := range lines[1:] {
+		lines[1+i] = strings.TrimPrefix(line, prefix)
+	}
 }
 
-// stripCommonPrefix removes a common prefix from /*-style comment lines (unless no
-// comment line is indented, all but the first line have some form of space prefix).
-// The prefix is computed using heuristics such that is likely that the comment
-// contents are nicely laid out after re-printing each line using the printer's
-// current indentation.
+// tripleQuoted returns the iGo triple-quoted string literal with the
+// contents s of a multi-line Go raw string literal. Its lines, and the
+// closing delimiter they are dedented against, are indented one level
+// deeper than the current line.
 //
-func stripCommonPrefix(lines []string) {
+func (p *printer) tripleQuoted(s string) string {
+	ws := strings.Repeat("\t", p.Config.Indent+p.indent+1)
+	lines := strings.Split(s, "\n")
 	for i, line := range lines {
-		line = trimPrefix(line)
-		line = trimRight(line)
-		line = trimSuffix(line)
-		lines[i] = "#" + line
+		if line != "" {
+			lines[i] = ws + line
+		}
 	}
+	return `"""` + "\n" + strings.Join(lines, "\n") + "\n" + ws + `"""`
 }
 
 func (p *printer) writeComment(comment *ast.Comment) {
@@ -494,23 +556,13 @@ func (p *printer) writeComment(comment *ast.Comment) {
 		return
 	}
 
-	// for /*-style comments, print line by line and let the
-	// write function take care of the proper indentation
-	lines := strings.Split(text, "\n")
-
-	// The comment started in the first column but is going
-	// to be indented. For an idempotent result, add indentation
-	// to all lines such that they look like they were indented
-	// before - this will make sure the common prefix computation
-	// is the same independent of how many times formatting is
-	// applied (was issue 1835).
-	if pos.IsValid() && pos.Column == 1 && p.indent > 0 {
-		for i, line := range lines[1:] {
-			lines[1+i] = "   " + line
-		}
-	}
-
-	stripCommonPrefix(lines)
+	// /*-style comments become #[-style comments ]#, printed line by
+	// line letting the write function take care of the indentation;
+	// a "]#" in the text would end the comment early, so it is escaped
+	// as "]\#", undoing the escaping of "*/" by to_go
+	text = iAst.ShiftEscapes(iAst.ShiftEscapes(text[2:len(text)-2], '*', '/', -1), ']', '#', 1)
+	lines := strings.Split("#["+text+"]#", "\n")
+	unindentLines(lines, pos.Column-1)
 
 	// write comment lines, separated by formfeed,
 	// without a line break after the last line
@@ -575,13 +627,6 @@ func (p *printer) intersperseComments(next token.Position, tok token.Token) (wro
 	var last *ast.Comment
 	for p.commentBefore(next) {
 		for _, c := range p.comment.List {
-			// if the last comment is a /*-style comment and the next item
-			// follows on the same line but is not a comma or a "closing"
-			// token, drop it
-			if c.Text[1] == '*' && p.lineFor(c.Pos()) == next.Line {
-				p.writeByte(' ', 1)
-				continue
-			}
 			p.writeCommentPrefix(p.posFor(c.Pos()), next, last, c, tok)
 			p.writeComment(c)
 			last = c
@@ -590,6 +635,13 @@ func (p *printer) intersperseComments(next token.Position, tok token.Token) (wro
 	}
 
 	if last != nil {
+		// if the last comment is a /*-style comment and the next item
+		// follows on the same line but is not a comma or a "closing"
+		// token, add an extra blank for separation
+		if last.Text[1] == '*' && p.lineFor(last.Pos()) == next.Line &&
+			tok != token.COMMA && tok != token.RPAREN && tok != token.RBRACK && tok != token.RBRACE {
+			p.writeByte(' ', 1)
+		}
 		// ensure that there is a line break after a //-style comment,
 		// before a closing '}' unless explicitly disabled, or at eof
 		needsLinebreak :=
@@ -605,6 +657,37 @@ func (p *printer) intersperseComments(next token.Position, tok token.Token) (wro
 	return
 }
 
+// closingComments prints the comments before the closing "}" at next of
+// a block, which is not printed in iGo, so that they stay in the block:
+// they are indented as the block's statements, after the nested blocks
+// closed before. Unlike intersperseComments, it leaves the buffered line
+// breaks to the tokens following the block.
+//
+func (p *printer) closingComments(next token.Position) {
+	last := -1
+	for i, ch := range p.wsbuf {
+		if ch == unindent {
+			last = i
+		}
+	}
+	for i := 0; i < last; i++ {
+		if p.wsbuf[i] == unindent {
+			p.indent--
+			p.wsbuf[i] = ignore
+		}
+	}
+
+	var prev *ast.Comment
+	for p.commentBefore(next) {
+		for _, c := range p.comment.List {
+			p.writeCommentPrefix(p.posFor(c.Pos()), next, prev, c, token.RBRACE)
+			p.writeComment(c)
+			prev = c
+		}
+		p.nextComment()
+	}
+}
+
 // whiteWhitespace writes the first n whitespace entries.
 func (p *printer) writeWhitespace(n int) {
 	// write entries
@@ -737,11 +820,22 @@ func (p *printer) print(args ...interface{}) {
 
 		case *ast.Ident:
 			data = x.Name
+			if iToken.Lookup(data).IsKeyword() || iParser.IsMacro(data) {
+				// a Go name which is an iGo keyword or source macro
+				data = "@" + data
+			}
 			impliedSemi = true
 			p.lastTok = token.IDENT
 
 		case *ast.BasicLit:
 			data = x.Value
+			if x.Kind == token.STRING && data[0] == '"' {
+				// "#{" starts an interpolation in iGo
+				data = strings.Replace(data, "#{", `\#{`, -1)
+			}
+			if x.Kind == token.STRING && data[0] == '`' && strings.Contains(data, "\n") && !strings.Contains(data, `"""`) {
+				data = p.tripleQuoted(data[1 : len(data)-1])
+			}
 			isLit = true
 			impliedSemi = true
 			p.lastTok = x.Kind
@@ -1052,6 +1146,8 @@ const (
 	TabIndent                  // use tabs for indentation independent of UseSpaces
 	UseSpaces                  // use spaces instead of tabs for alignment
 	SourcePos                  // emit //line comments to preserve original source positions
+	PostfixIf                  // print single-statement if statements with statement modifiers
+	Methods                    // print consecutive methods with the same receiver in methods blocks
 )
 
 // A Config node controls the output of Fprint.
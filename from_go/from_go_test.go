@@ -0,0 +1,415 @@
+package from_go_test
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/DAddYE/igo/from_go"
+	iParser "github.com/DAddYE/igo/parser"
+	"github.com/DAddYE/igo/to_go"
+	iToken "github.com/DAddYE/igo/token"
+)
+
+// roundTrips holds Go sources which come back unchanged once printed
+// as iGo and compiled back to Go.
+var roundTrips = []struct {
+	name string
+	src  string
+}{
+	{"block comment markers", `package p
+
+/* a ]# b *\/ c ]\# d *\\/ e */
+var x = 1
+`},
+	{"block comment indentation", `package p
+
+/*
+   foo
+     bar
+*/
+
+/* Package p does
+   things.
+*/
+
+func f() {
+	/* a
+	     b
+	   c */
+	g()
+}
+`},
+	{"trailing function literal", `package p
+
+func f() {
+	run(func(c int) { // first comment
+		// second comment
+		use(c)
+		{
+		}
+		x := 1 // trailing
+		_ = x
+	})
+
+	done()
+}
+`},
+	{"struct field comments", `package p
+
+type S struct {
+	// Mention field.
+	a int
+	// Other.
+	b, c string
+}
+`},
+	{"argument comments", `package p
+
+func f() {
+	g(1, /* two */ 2, 3)
+	g(1 /* one */, 2)
+}
+`},
+	{"build constraints", `//go:build linux && !cgo
+// +build linux,!cgo
+
+// Package p does things.
+package p
+`},
+	{"embed directives", `package p
+
+import "embed"
+
+//go:generate stringer -type=T
+
+//go:embed a.txt
+var s string
+
+var (
+	x = 1
+	//go:embed b.txt
+	//go:embed c.txt
+	fs embed.FS
+)
+
+// b is embedded.
+//
+//go:embed d.txt
+var b []byte
+`},
+	{"cgo preamble", `package p
+
+import "fmt"
+
+/*
+#include <stdio.h>
+#cgo LDFLAGS: -lm
+*/
+import "C"
+
+// #include <stdlib.h>
+import "C"
+
+var x = fmt.Sprint(C.int(1))
+`},
+	{"go bodies in loops", `package p
+
+func f(xs []int) {
+	for _, x := range xs {
+		go func() {
+			use(x)
+		}()
+		defer func() {
+			done()
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		x := i
+		go func() {
+			use(x)
+		}()
+	}
+}
+`},
+	{"triple-quoted strings", `package p
+
+const q = ` + "`" + `SELECT *
+FROM t
+	WHERE x = 1` + "`" + `
+
+var t = ` + "`" + `
+{{.Name}}
+` + "`" + `
+`},
+	{"generics", `package p
+
+type Number interface {
+	~int | ~int64 | float64
+}
+
+func Sum[T Number](xs []T) T {
+	var s T
+	for _, x := range xs {
+		s += x
+	}
+
+	return s
+}
+
+type Pair[K comparable, V any] struct {
+	Key K
+	Val V
+}
+
+var p = Pair[string, int]{Key: "a", Val: 1}
+
+var n = Sum[int]([]int{1, 2})
+`},
+	{"type aliases", `package p
+
+import "io"
+
+type R = io.Reader
+
+type (
+	W = io.Writer
+	N int
+)
+`},
+	{"range over ints and functions", `package p
+
+func Seq2(yield func(int, string) bool) {}
+
+func f(n int) {
+	for i := range 10 {
+		use(i)
+	}
+
+	for range n {
+		use(0)
+	}
+
+	for k, v := range Seq2 {
+		use(k, v)
+	}
+}
+`},
+	{"empty bodies", `package p
+
+func Seq2(yield func(int, string) bool) {}
+
+func f(x bool, xs []int) {
+	if x {
+	} else if !x {
+	} else {
+	}
+	for {
+	}
+	for range xs {
+	}
+	for range Seq2 {
+	}
+	for i := 0; i < 3; i++ {
+	}
+}
+`},
+	{"elided composite keys", `package p
+
+var m = map[[2]int]string{
+	{1, 2}: "a",
+	{3, 4}: "b",
+}
+`},
+	{"conditionals calling functions", `package p
+
+func a() int { return 1 }
+
+func f(c bool) {
+	use(func() int {
+		if c {
+			return a()
+		}
+		return 3
+	}())
+}
+`},
+	{"escaped keywords", `package p
+
+type T struct {
+	do int
+}
+
+func (self *T) Do() int {
+	do := self.do
+	return do
+}
+
+func (self T) __line__() {}
+`},
+	{"implements declarations", `package p
+
+import (
+	"io"
+	"net/http"
+)
+
+type Server struct{}
+
+var _ http.Handler = (*Server)(nil)
+var _ io.Closer = (*Server)(nil)
+`},
+	{"hoisted conditionals", `package p
+
+func f(c, d bool) int {
+	var x int
+	if c {
+		x = 1
+	} else {
+		x = 2
+	}
+	var y string
+	if c {
+		y = "a"
+	} else if d {
+		y = "b"
+	} else {
+		y = "c"
+	}
+	use(y)
+	return x
+}
+`},
+	{"indented composite literals", `package p
+
+type Config struct {
+	Name  string
+	Ports []int
+	Tags  map[string]string
+}
+
+var c = Config{
+	Name:  "srv",
+	Ports: []int{80, 443},
+	Tags: map[string]string{
+		"env": "prod",
+		"os":  "linux",
+	},
+}
+
+var grid = [][]int{
+	{1, 2},
+	{3, 4},
+}
+
+func f() {
+	use(Config{
+		Name: "x",
+	})
+	m := map[string]Config{
+		"a": {
+			Name: "a",
+		},
+	}
+	use(m)
+}
+`},
+}
+
+// modeRoundTrips holds Go sources which come back unchanged once printed
+// as iGo in the given mode and compiled back to Go.
+var modeRoundTrips = []struct {
+	name string
+	mode from_go.Mode
+	src  string
+}{
+	{"postfix conditionals", from_go.PostfixIf, `package p
+
+func f(xs []int, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, x := range xs {
+		if x == 0 {
+			continue
+		}
+		use(x)
+	}
+
+	return nil
+}
+`},
+	{"methods blocks", from_go.Methods, `package p
+
+type Server struct {
+	addr string
+}
+
+func (s *Server) Addr() string { return s.addr }
+
+func (s *Server) SetAddr(addr string) {
+	s.addr = addr
+}
+
+func (self Server) String() string { return self.addr }
+`},
+}
+
+// toIgo prints the Go source src as iGo in the given mode.
+func toIgo(t *testing.T, src string, mode from_go.Mode) []byte {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "test.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	cfg := &from_go.Config{Mode: mode | from_go.UseSpaces | from_go.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// toGo compiles the iGo source src to Go.
+func toGo(t *testing.T, src []byte) []byte {
+	fset := iToken.NewFileSet()
+	file, err := iParser.ParseFile(fset, "test.igo", src, iParser.ParseComments)
+	if err != nil {
+		t.Fatalf("%s\n%s", err, src)
+	}
+	var buf bytes.Buffer
+	cfg := &to_go.Config{Mode: to_go.UseSpaces | to_go.TabIndent, Tabwidth: 8}
+	if _, err := cfg.Fprint(&buf, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tt := range roundTrips {
+		t.Run(tt.name, func(t *testing.T) {
+			igo := toIgo(t, tt.src, 0)
+			if bytes.Contains(igo, []byte("go!")) {
+				t.Errorf("printed as Go:\n%s", igo)
+			}
+			if got, want := toGo(t, igo), []byte(tt.src); !bytes.Equal(got, want) {
+				t.Errorf("got:\n%s\nwant:\n%s\niGo:\n%s", got, want, igo)
+			}
+		})
+	}
+}
+
+func TestModeRoundTrip(t *testing.T) {
+	for _, tt := range modeRoundTrips {
+		t.Run(tt.name, func(t *testing.T) {
+			igo := toIgo(t, tt.src, tt.mode)
+			if bytes.Contains(igo, []byte("go!")) {
+				t.Errorf("printed as Go:\n%s", igo)
+			}
+			if got, want := toGo(t, igo), []byte(tt.src); !bytes.Equal(got, want) {
+				t.Errorf("got:\n%s\nwant:\n%s\niGo:\n%s", got, want, igo)
+			}
+		})
+	}
+}
@@ -11,9 +11,13 @@ package from_go
 import (
 	"bytes"
 	"go/ast"
+	goprinter "go/printer"
 	"go/token"
+	"sort"
+	"strings"
 	"unicode/utf8"
 
+	iParser "github.com/DAddYE/igo/parser"
 	iToken "github.com/DAddYE/igo/token"
 )
 
@@ -113,6 +117,18 @@ func (p *printer) identList(list []*ast.Ident, indent bool) {
 	p.exprList(token.NoPos, xlist, 1, mode, token.NoPos)
 }
 
+// commaPos returns the position to print the comma between the list
+// entries prev and x at: the position of x, unless the next comment lies
+// between them and is set off from x by less space than from prev, as in
+// "a, /* c */ b", where it follows the comma.
+func (p *printer) commaPos(prev, x ast.Expr) token.Pos {
+	if c := p.comment; c != nil && prev.End() <= c.Pos() && c.End() <= x.Pos() &&
+		p.lineFor(prev.End()) == p.lineFor(x.Pos()) && c.Pos()-prev.End() > x.Pos()-c.End() {
+		return prev.End()
+	}
+	return x.Pos()
+}
+
 // Print a list of expressions. If the list spans multiple
 // source lines, the original line breaks are respected between
 // expressions.
@@ -136,7 +152,7 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 			if i > 0 {
 				// use position of expression following the comma as
 				// comma position for correct comment placement
-				p.print(x.Pos(), token.COMMA, blank)
+				p.print(p.commaPos(list[i-1], x), token.COMMA, blank)
 			}
 			p.expr0(x, depth)
 		}
@@ -215,7 +231,7 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 			// comma position for correct comment placement, but
 			// only if the expression is on the same line
 			if !needsLinebreak {
-				p.print(x.Pos())
+				p.print(p.commaPos(list[i-1], x))
 			}
 			p.print(token.COMMA)
 			needsBlank := true
@@ -263,8 +279,20 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 	}
 }
 
-func (p *printer) parameters(fields *ast.FieldList) {
-	p.print(fields.Opening, token.LPAREN)
+type paramMode int
+
+const (
+	funcParam paramMode = iota
+	funcTParam
+	typeTParam
+)
+
+func (p *printer) parameters(fields *ast.FieldList, mode paramMode) {
+	openTok, closeTok := token.LPAREN, token.RPAREN
+	if mode != funcParam {
+		openTok, closeTok = token.LBRACK, token.RBRACK
+	}
+	p.print(fields.Opening, openTok)
 	if len(fields.List) > 0 {
 		prevLine := p.lineFor(fields.Opening)
 		ws := indent
@@ -317,18 +345,57 @@ func (p *printer) parameters(fields *ast.FieldList) {
 		if closing := p.lineFor(fields.Closing); 0 < prevLine && prevLine < closing {
 			p.print(token.COMMA)
 			p.linebreak(closing, 0, ignore, true)
+		} else if mode == typeTParam && fields.NumFields() == 1 && combinesWithName(fields.List[0].Type) {
+			// A type parameter list [P T] where the name P and the type expression T
+			// syntactically combine to another valid (value) expression requires a
+			// trailing comma, as in [P *T,], not to be taken for an array length.
+			p.print(token.COMMA)
 		}
 		// unindent if we indented
 		if ws == ignore {
 			p.print(unindent)
 		}
 	}
-	p.print(fields.Closing, token.RPAREN)
+	p.print(fields.Closing, closeTok)
+}
+
+// combinesWithName reports whether a name followed by the expression x
+// syntactically combines to another valid (value) expression. For instance
+// using *T for x, "name *T" syntactically appears as the expression x*T.
+// On the other hand, using P|Q or *P|~Q for x, "name P|Q" or "name *P|~Q"
+// cannot be combined into a valid (value) expression.
+func combinesWithName(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.StarExpr:
+		// name *x.X combines to name*x.X if x.X is not a type element
+		return !isTypeElem(x.X)
+	case *ast.BinaryExpr:
+		return combinesWithName(x.X) && !isTypeElem(x.Y)
+	case *ast.ParenExpr:
+		return combinesWithName(x.X)
+	}
+	return false
+}
+
+// isTypeElem reports whether x is a (possibly parenthesized) type element expression.
+// The result is false if x could be a type element OR an ordinary (value) expression.
+func isTypeElem(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.ArrayType, *ast.StructType, *ast.FuncType, *ast.InterfaceType, *ast.MapType, *ast.ChanType:
+		return true
+	case *ast.UnaryExpr:
+		return x.Op == token.TILDE
+	case *ast.BinaryExpr:
+		return isTypeElem(x.X) || isTypeElem(x.Y)
+	case *ast.ParenExpr:
+		return isTypeElem(x.X)
+	}
+	return false
 }
 
 func (p *printer) signature(params, result *ast.FieldList) {
 	if params != nil {
-		p.parameters(params)
+		p.parameters(params, funcParam)
 	} else {
 		p.print(token.LPAREN, token.RPAREN)
 	}
@@ -341,7 +408,7 @@ func (p *printer) signature(params, result *ast.FieldList) {
 			p.expr(stripParensAlways(result.List[0].Type))
 			return
 		}
-		p.parameters(result)
+		p.parameters(result, funcParam)
 	}
 }
 
@@ -395,11 +462,17 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 		// possibly a one-line struct/interface
 		if len(list) == 0 {
 			return
-		} else if isStruct && p.isOneLineFieldList(list) { // for now ignore interfaces
+		} else if p.isOneLineFieldList(list) {
 			// small enough - print on one line
 			// (don't use identList and ignore source line breaks)
 			p.print(lbrace, token.COLON, blank)
 			f := list[0]
+			if ftyp, isFtyp := f.Type.(*ast.FuncType); !isStruct && isFtyp && len(f.Names) > 0 {
+				// interface method
+				p.expr(f.Names[0])
+				p.signature(ftyp.Params, ftyp.Results)
+				return
+			}
 			for i, x := range f.Names {
 				if i > 0 {
 					// no comments so no need for comma position
@@ -416,11 +489,13 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 	}
 	// hasComments || !srcIsOneLine
 
+	// indent before the line break, so a comment leading the
+	// first field is printed at its indentation
+	p.print(indent)
 	if hasComments || len(list) > 0 {
 		p.print(formfeed)
 	}
 
-	p.print(indent)
 	if isStruct {
 
 		sep := vtab
@@ -772,6 +847,13 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		p.expr0(x.Index, depth+1)
 		p.print(x.Rbrack, token.RBRACK)
 
+	case *ast.IndexListExpr:
+		// TODO(gri): as for IndexExpr, should treat [] like parentheses
+		p.expr1(x.X, token.HighestPrec, 1)
+		p.print(x.Lbrack, token.LBRACK)
+		p.exprList(x.Lbrack, x.Indices, depth+1, commaTerm, x.Rbrack)
+		p.print(x.Rbrack, token.RBRACK)
+
 	case *ast.SliceExpr:
 		// TODO(gri): should treat[] like parentheses and undo one level of depth
 		p.expr1(x.X, token.HighestPrec, 1)
@@ -791,6 +873,10 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		p.print(x.Rbrack, token.RBRACK)
 
 	case *ast.CallExpr:
+		if conds, values := p.condCall(x); conds != nil {
+			p.condExpr(conds, values, x.Rparen, prec1, depth)
+			break
+		}
 		if len(x.Args) > 1 {
 			depth++
 		}
@@ -814,13 +900,16 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 
 			if len(x.Args) > 0 {
 				last := x.Args[len(x.Args)-1]
-				if fn, ok := last.(*ast.FuncLit); ok {
+				if fn, ok := last.(*ast.FuncLit); ok && x == p.doCall {
 					args := x.Args[:len(x.Args)-1]
-					p.exprList(x.Lparen, args, depth, commaTerm, x.Rparen)
-					p.print(x.Rparen, token.RPAREN)
+					// the closing parenthesis is printed at the function
+					// literal so comments in its body stay in the do block
+					p.exprList(x.Lparen, args, depth, commaTerm, fn.Pos())
+					p.print(fn.Pos(), token.RPAREN)
 					p.print(blank, iToken.DO)
 					p.signature(fn.Type.Params, fn.Type.Results)
 					p.adjBlock(fn.Body)
+					p.print(x.Rparen)
 				} else {
 					p.exprList(x.Lparen, x.Args, depth, commaTerm, x.Rparen)
 					p.print(x.Rparen, token.RPAREN)
@@ -831,6 +920,10 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		}
 
 	case *ast.CompositeLit:
+		if p.isIndentedLit(x) {
+			p.indentedLit(x, depth)
+			break
+		}
 		// composite literal elements that are composite literals themselves may have the type omitted
 		if x.Type != nil {
 			p.expr1(x.Type, token.HighestPrec, depth)
@@ -917,7 +1010,8 @@ func (p *printer) stmtList(list []ast.Stmt, nindent int, nextIsRBrace bool) {
 	}
 	multiLine := false
 	i := 0
-	for _, s := range list {
+	for j := 0; j < len(list); j++ {
+		s := list[j]
 		// ignore empty statements (was issue 3466)
 		if _, isEmpty := s.(*ast.EmptyStmt); !isEmpty {
 			// _indent == 0 only for lists of switch/select case clauses;
@@ -927,6 +1021,20 @@ func (p *printer) stmtList(list []ast.Stmt, nindent int, nextIsRBrace bool) {
 				// (i.e., we are not printing only a partial program)
 				p.linebreak(p.lineFor(s.Pos()), 1, ignore, i == 0 || nindent == 0 || multiLine)
 			}
+			if b, isBlock := s.(*ast.BlockStmt); isBlock {
+				// scoped block
+				p.print(b.Pos(), iToken.DO)
+			}
+			if conds, values := p.condDecl(list, j); conds != nil {
+				// the declaration takes in the if statement after it
+				p.condDeclStmt(s.(*ast.DeclStmt), list[j+1].(*ast.IfStmt), conds, values)
+				multiLine = false
+				j++
+				i++
+				continue
+			}
+			p.doCall = trailingCall(s)
+			p.blockLit = trailingLit(s)
 			p.stmt(s, nextIsRBrace && i == len(list)-1)
 			multiLine = p.isMultiLine(s)
 			i++
@@ -941,9 +1049,39 @@ func (p *printer) stmtList(list []ast.Stmt, nindent int, nextIsRBrace bool) {
 }
 
 // block prints an *ast.BlockStmt; it always spans at least two lines.
+// An empty indented block without comments is written as a colon ending
+// the line of its header, as in "for:".
+//
 func (p *printer) block(b *ast.BlockStmt, nindent int) {
+	if nindent > 0 && p.isEmpty(b) {
+		p.emptyBody()
+		// continue as if the closing "}" was printed
+		p.pos = p.posFor(b.Rbrace)
+		p.last = p.pos
+		return
+	}
 	p.stmtList(b.List, nindent, true)
 	p.linebreak(p.lineFor(b.Rbrace), 1, ignore, true)
+	if rbrace := p.posFor(b.Rbrace); p.commentBefore(rbrace) {
+		p.closingComments(rbrace)
+	}
+}
+
+// isEmpty reports whether the block b holds neither statements nor
+// comments, and is then printed as a colon.
+//
+func (p *printer) isEmpty(b *ast.BlockStmt) bool {
+	return len(b.List) == 0 && !p.commentBefore(p.posFor(b.Rbrace))
+}
+
+// emptyBody prints the colon of an empty body, dropping the blank which
+// separates the header from the opening "{" in Go.
+//
+func (p *printer) emptyBody() {
+	for n := len(p.wsbuf); n > 0 && p.wsbuf[n-1] == blank; n-- {
+		p.wsbuf = p.wsbuf[:n-1]
+	}
+	p.print(token.COLON)
 }
 
 func isTypeName(x ast.Expr) bool {
@@ -1069,6 +1207,168 @@ func (p *printer) alignFuncIndent() {
 	}
 }
 
+// trailingCall returns the call expression ending the statement s, if
+// any. A function literal passed as its final argument can be printed
+// as a trailing do block, since nothing follows it in the statement.
+//
+func trailingCall(s ast.Stmt) *ast.CallExpr {
+	var x ast.Expr
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		x = s.X
+	case *ast.AssignStmt:
+		x = s.Rhs[len(s.Rhs)-1]
+	case *ast.ReturnStmt:
+		if len(s.Results) > 0 {
+			x = s.Results[len(s.Results)-1]
+		}
+	case *ast.GoStmt:
+		x = s.Call
+	case *ast.DeferStmt:
+		x = s.Call
+	}
+	call, _ := x.(*ast.CallExpr)
+	return call
+}
+
+// trailingLit returns the composite literal, or the address of one,
+// ending the statement s, if any. Since nothing follows it in the
+// statement, its elements can be indented below its type.
+//
+func trailingLit(s ast.Stmt) *ast.CompositeLit {
+	var list []ast.Expr
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		list = s.Rhs
+	case *ast.ReturnStmt:
+		list = s.Results
+	}
+	if len(list) == 0 {
+		return nil
+	}
+	return compositeLit(list[len(list)-1])
+}
+
+// compositeLit returns x if it is a composite literal, or the composite
+// literal whose address x takes; otherwise it returns nil.
+func compositeLit(x ast.Expr) *ast.CompositeLit {
+	if u, isUnary := x.(*ast.UnaryExpr); isUnary && u.Op == token.AND {
+		x = u.X
+	}
+	lit, _ := x.(*ast.CompositeLit)
+	return lit
+}
+
+// isIndentedLit reports whether the composite literal x is printed with
+// its elements indented below its type: it ends the current statement,
+// declaration or element, and spans several lines.
+func (p *printer) isIndentedLit(x *ast.CompositeLit) bool {
+	return x == p.blockLit && len(x.Elts) > 0 && p.lineFor(x.Lbrace) < p.lineFor(x.Rbrace)
+}
+
+// indentedLit prints the composite literal x, for which isIndentedLit
+// holds, with its elements indented below its type instead of between
+// braces. The elements keep their lines, separated by commas on shared
+// ones. A composite literal ending a line is printed the same way,
+// without its type after a key if it is elided.
+//
+func (p *printer) indentedLit(x *ast.CompositeLit, depth int) {
+	if x.Type != nil {
+		p.expr1(x.Type, token.HighestPrec, depth)
+	}
+	p.print(x.Lbrace, indent)
+	line := p.lineFor(x.Lbrace)
+	multiLine := false
+	for i, e := range x.Elts {
+		if i == 0 || line < p.lineFor(e.Pos()) {
+			p.linebreak(p.lineFor(e.Pos()), 1, ignore, i == 0 || multiLine)
+		} else {
+			p.print(token.COMMA, blank)
+		}
+		line = p.lineFor(e.End())
+		last := i == len(x.Elts)-1 || line < p.lineFor(x.Elts[i+1].Pos())
+		p.blockLit = nil
+		if kv, isPair := e.(*ast.KeyValueExpr); isPair {
+			lit := compositeLit(kv.Value)
+			if last {
+				p.blockLit = lit
+			}
+			p.expr(kv.Key)
+			p.print(kv.Colon, token.COLON)
+			if kv.Value != lit || lit.Type != nil || !p.isIndentedLit(lit) {
+				p.print(vtab)
+			}
+			p.expr(kv.Value)
+		} else {
+			if lit := compositeLit(e); last && lit != nil && lit.Type != nil {
+				p.blockLit = lit
+			}
+			p.expr0(e, 1)
+		}
+		multiLine = p.isMultiLine(e)
+	}
+	// the comments before the closing brace stay among the elements,
+	// which a line break ends in iGo
+	if rbrace := p.posFor(x.Rbrace); p.commentOffset < rbrace.Offset {
+		p.impliedSemi = false
+		p.closingComments(rbrace)
+	}
+	p.print(x.Rbrace, unindent)
+}
+
+// bodyCall returns the function literal without parameters or results
+// called without arguments by the go or defer statement with call, whose
+// body can be printed in place of the call, or nil. A body referring to
+// the variables of the enclosing loops is not, as to_go would copy them.
+//
+func (p *printer) bodyCall(call *ast.CallExpr) *ast.FuncLit {
+	lit, isLit := call.Fun.(*ast.FuncLit)
+	if !isLit || len(call.Args) > 0 || lit.Type.TypeParams != nil ||
+		lit.Type.Params.NumFields() > 0 || lit.Type.Results.NumFields() > 0 {
+		return nil
+	}
+	if len(p.loops) > 0 {
+		loop := make(map[*ast.Object]bool)
+		for _, obj := range p.loops {
+			loop[obj] = true
+		}
+		captured := false
+		ast.Inspect(lit.Body, func(n ast.Node) bool {
+			if x, isIdent := n.(*ast.Ident); isIdent && loop[x.Obj] {
+				captured = true
+			}
+			return !captured
+		})
+		if captured {
+			return nil
+		}
+	}
+	return lit
+}
+
+// loopVars returns the variables declared by the for statement s.
+func loopVars(s ast.Stmt) []*ast.Object {
+	var list []*ast.Object
+	add := func(xs ...ast.Expr) {
+		for _, x := range xs {
+			if x, isIdent := x.(*ast.Ident); isIdent && x.Obj != nil && x.Name != "_" {
+				list = append(list, x.Obj)
+			}
+		}
+	}
+	switch s := s.(type) {
+	case *ast.ForStmt:
+		if init, isAssign := s.Init.(*ast.AssignStmt); isAssign && init.Tok == token.DEFINE {
+			add(init.Lhs...)
+		}
+	case *ast.RangeStmt:
+		if s.Tok == token.DEFINE {
+			add(s.Key, s.Value)
+		}
+	}
+	return list
+}
+
 func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 	p.print(stmt.Pos())
 
@@ -1121,10 +1421,20 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		p.exprList(s.TokPos, s.Rhs, depth, 0, token.NoPos)
 
 	case *ast.GoStmt:
+		if lit := p.bodyCall(s.Call); lit != nil {
+			p.print(token.GO)
+			p.adjBlock(lit.Body)
+			break
+		}
 		p.print(token.GO, blank)
 		p.expr(s.Call)
 
 	case *ast.DeferStmt:
+		if lit := p.bodyCall(s.Call); lit != nil {
+			p.print(token.DEFER)
+			p.adjBlock(lit.Body)
+			break
+		}
 		p.print(token.DEFER, blank)
 		p.expr(s.Call)
 
@@ -1154,17 +1464,31 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		}
 
 	case *ast.BlockStmt:
+		if len(s.List) == 0 {
+			p.emptyBody()
+			p.print(s.Rbrace)
+			break
+		}
 		p.block(s, 1)
 
 	case *ast.IfStmt:
+		if p.Config.Mode&PostfixIf != 0 && s != p.elseIf && p.isPostfix(s) {
+			p.postfixStmt(s)
+			break
+		}
 		p.print(token.IF)
 		p.controlClause(false, s.Init, s.Cond, nil)
 		p.block(s.Body, 1)
 		if s.Else != nil {
-			p.print(token.ELSE)
+			// "else" follows the "}" of the body
+			if p.isEmpty(s.Body) {
+				p.print(formfeed)
+			}
+			p.print(s.Body.Rbrace, token.ELSE)
 			switch s.Else.(type) {
 			case *ast.BlockStmt, *ast.IfStmt:
 				p.print(blank)
+				p.elseIf, _ = s.Else.(*ast.IfStmt)
 				p.stmt(s.Else, nextIsRBrace)
 			default:
 				p.print(indent, formfeed)
@@ -1228,21 +1552,30 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 	case *ast.ForStmt:
 		p.print(token.FOR)
 		p.controlClause(true, s.Init, s.Cond, s.Post)
+		n := len(p.loops)
+		p.loops = append(p.loops, loopVars(s)...)
 		p.block(s.Body, 1)
+		p.loops = p.loops[:n]
 
 	case *ast.RangeStmt:
 		p.print(token.FOR, blank)
-		p.expr(s.Key)
-		if s.Value != nil {
-			// use position of value following the comma as
-			// comma position for correct comment placement
-			p.print(s.Value.Pos(), token.COMMA, blank)
-			p.expr(s.Value)
-		}
-		p.print(blank, s.TokPos, s.Tok, blank, token.RANGE, blank)
+		if s.Key != nil {
+			p.expr(s.Key)
+			if s.Value != nil {
+				// use position of value following the comma as
+				// comma position for correct comment placement
+				p.print(s.Value.Pos(), token.COMMA, blank)
+				p.expr(s.Value)
+			}
+			p.print(blank, s.TokPos, s.Tok, blank)
+		}
+		p.print(token.RANGE, blank)
 		p.expr(stripParens(s.X))
 		p.print(blank)
+		n := len(p.loops)
+		p.loops = append(p.loops, loopVars(s)...)
 		p.block(s.Body, 1)
+		p.loops = p.loops[:n]
 
 	default:
 		panic("unreachable")
@@ -1332,6 +1665,7 @@ func (p *printer) valueSpec(s *ast.ValueSpec, keepType bool) {
 	}
 	if s.Values != nil {
 		p.print(vtab, token.ASSIGN, blank)
+		p.blockLit = compositeLit(s.Values[len(s.Values)-1])
 		p.exprList(token.NoPos, s.Values, 1, 0, token.NoPos)
 		extraTabs--
 	}
@@ -1371,6 +1705,7 @@ func (p *printer) spec(spec ast.Spec, n int, doIndent bool) {
 		}
 		if s.Values != nil {
 			p.print(blank, token.ASSIGN, blank)
+			p.blockLit = compositeLit(s.Values[len(s.Values)-1])
 			p.exprList(token.NoPos, s.Values, 1, 0, token.NoPos)
 		}
 		p.setComment(s.Comment)
@@ -1378,11 +1713,17 @@ func (p *printer) spec(spec ast.Spec, n int, doIndent bool) {
 	case *ast.TypeSpec:
 		p.setComment(s.Doc)
 		p.expr(s.Name)
+		if s.TypeParams != nil {
+			p.parameters(s.TypeParams, typeTParam)
+		}
 		if n == 1 {
 			p.print(blank)
 		} else {
 			p.print(vtab)
 		}
+		if s.Assign.IsValid() {
+			p.print(token.ASSIGN, blank)
+		}
 		p.expr(s.Type)
 		p.setComment(s.Comment)
 
@@ -1391,6 +1732,51 @@ func (p *printer) spec(spec ast.Spec, n int, doIndent bool) {
 	}
 }
 
+// implementsAssertion returns the type name and the interface of the
+// declaration d if it is an assertion "var _ I = (*T)(nil)", which iGo
+// writes "type T implements I"; otherwise it returns nil, nil.
+//
+func implementsAssertion(d *ast.GenDecl) (*ast.Ident, ast.Expr) {
+	if d.Tok != token.VAR || d.Lparen.IsValid() || len(d.Specs) != 1 {
+		return nil, nil
+	}
+	s := d.Specs[0].(*ast.ValueSpec)
+	if len(s.Names) != 1 || s.Names[0].Name != "_" || s.Type == nil || len(s.Values) != 1 {
+		return nil, nil
+	}
+	call, isCall := s.Values[0].(*ast.CallExpr)
+	if !isCall || len(call.Args) != 1 || call.Ellipsis.IsValid() {
+		return nil, nil
+	}
+	if arg, isIdent := call.Args[0].(*ast.Ident); !isIdent || arg.Name != "nil" {
+		return nil, nil
+	}
+	paren, isParen := call.Fun.(*ast.ParenExpr)
+	if !isParen {
+		return nil, nil
+	}
+	star, isStar := paren.X.(*ast.StarExpr)
+	if !isStar {
+		return nil, nil
+	}
+	name, isIdent := star.X.(*ast.Ident)
+	if !isIdent {
+		return nil, nil
+	}
+	return name, s.Type
+}
+
+// implementsDecl prints the assertion d that the type named name
+// implements the interface typ as "type name implements typ".
+func (p *printer) implementsDecl(d *ast.GenDecl, name *ast.Ident, typ ast.Expr) {
+	p.setComment(d.Doc)
+	p.print(d.Pos(), token.TYPE, blank)
+	p.expr(&ast.Ident{NamePos: d.Pos(), Name: name.Name})
+	p.print(blank, iToken.IMPLEMENTS, blank)
+	p.expr(typ)
+	p.setComment(d.Specs[0].(*ast.ValueSpec).Comment)
+}
+
 func (p *printer) genDecl(d *ast.GenDecl) {
 	p.setComment(d.Doc)
 	p.print(d.Pos(), d.Tok, blank)
@@ -1430,6 +1816,319 @@ func (p *printer) genDecl(d *ast.GenDecl) {
 	}
 }
 
+// isPostfix reports whether the if statement s can be printed with a
+// statement modifier: it has neither init statement nor else branch,
+// its body is a single simple (but not declaring), go, defer, return
+// or branch statement, and it fits on one line without comments.
+//
+func (p *printer) isPostfix(s *ast.IfStmt) bool {
+	if s.Init != nil || s.Else != nil || len(s.Body.List) != 1 {
+		return false
+	}
+	switch b := s.Body.List[0].(type) {
+	case *ast.AssignStmt:
+		if b.Tok == token.DEFINE {
+			return false
+		}
+	case *ast.ExprStmt, *ast.SendStmt, *ast.IncDecStmt, *ast.GoStmt, *ast.DeferStmt,
+		*ast.ReturnStmt, *ast.BranchStmt:
+		// ok
+	default:
+		return false
+	}
+	if p.hasComments(s.Pos(), s.End()) {
+		return false
+	}
+	const maxSize = 100
+	return p.nodeSize(s.Body.List[0], maxSize)+p.nodeSize(s.Cond, maxSize) <= maxSize
+}
+
+// postfixStmt prints the if statement s, for which isPostfix holds, as
+// its body followed by an "if" modifier, or an "unless" modifier if the
+// condition is a negation.
+//
+func (p *printer) postfixStmt(s *ast.IfStmt) {
+	// the comments before s precede the "if", not its body
+	if next := p.posFor(s.Pos()); p.commentBefore(next) {
+		p.flush(next, token.IF)
+	}
+	p.stmt(s.Body.List[0], false)
+	if x, isUnary := s.Cond.(*ast.UnaryExpr); isUnary && x.Op == token.NOT {
+		p.print(blank, iToken.UNLESS, blank)
+		p.expr(stripParensAlways(x.X))
+	} else {
+		p.print(blank, token.IF, blank)
+		p.expr(s.Cond)
+	}
+	// continue as if the closing "}" was printed
+	p.pos = p.posFor(s.Body.Rbrace)
+	p.last = p.pos
+}
+
+// condCall returns the conditions and the values of the call x if it is
+// a function literal called in place which returns the value following
+// the first condition holding, as iGo lowers "a if c else b":
+//
+//	func() T {
+//		if c {
+//			return a
+//		}
+//		return b
+//	}()
+//
+// One of the values must tell the result type T as iGo infers it: a
+// composite literal or a conversion of type T, or a call of a function
+// declared in the file returning a T. Or else all of them are literals
+// of type T by default. Otherwise condCall returns nil, nil.
+//
+func (p *printer) condCall(x *ast.CallExpr) (conds, values []ast.Expr) {
+	lit, isLit := x.Fun.(*ast.FuncLit)
+	if !isLit || len(x.Args) != 0 || lit.Type.Params.NumFields() != 0 {
+		return nil, nil
+	}
+	results := lit.Type.Results
+	if results.NumFields() != 1 || len(results.List[0].Names) != 0 || len(lit.Body.List) < 2 {
+		return nil, nil
+	}
+	list := lit.Body.List
+	for _, s := range list[:len(list)-1] {
+		s, isIf := s.(*ast.IfStmt)
+		if !isIf || s.Init != nil || s.Else != nil || len(s.Body.List) != 1 {
+			return nil, nil
+		}
+		v := returnedValue(s.Body.List[0])
+		if v == nil {
+			return nil, nil
+		}
+		conds, values = append(conds, s.Cond), append(values, v)
+	}
+	v := returnedValue(list[len(list)-1])
+	if v == nil || p.hasComments(x.Pos(), x.End()) {
+		return nil, nil
+	}
+	values = append(values, v)
+
+	typ := p.exprString(results.List[0].Type)
+	literals := true
+	for _, v := range values {
+		switch {
+		case p.typedAs(v, typ):
+			return conds, values
+		case !isLiteralOf(v, typ):
+			literals = false
+		}
+	}
+	if !literals {
+		return nil, nil
+	}
+	return conds, values
+}
+
+// returnedValue returns the value returned by s if it is a return
+// statement with a single result, or nil.
+//
+func returnedValue(s ast.Stmt) ast.Expr {
+	if r, isReturn := s.(*ast.ReturnStmt); isReturn && len(r.Results) == 1 {
+		return r.Results[0]
+	}
+	return nil
+}
+
+// typedAs reports whether x is a composite literal, a pointer to one,
+// a conversion or a call of a function declared in the file whose type
+// is written typ.
+//
+func (p *printer) typedAs(x ast.Expr, typ string) bool {
+	switch x := x.(type) {
+	case *ast.CompositeLit:
+		return x.Type != nil && p.exprString(x.Type) == typ
+	case *ast.UnaryExpr:
+		if lit, isLit := x.X.(*ast.CompositeLit); isLit && x.Op == token.AND && lit.Type != nil {
+			return "*"+p.exprString(lit.Type) == typ
+		}
+	case *ast.CallExpr:
+		id, isIdent := x.Fun.(*ast.Ident)
+		if !isIdent {
+			return false
+		}
+		if id.Obj != nil && id.Obj.Kind == ast.Fun {
+			// a call of a function declared in the file
+			d, isFunc := id.Obj.Decl.(*ast.FuncDecl)
+			if !isFunc || d.Type.TypeParams != nil {
+				return false
+			}
+			results := d.Type.Results
+			return results.NumFields() == 1 && p.exprString(results.List[0].Type) == typ
+		}
+		return len(x.Args) == 1 && !x.Ellipsis.IsValid() && id.Name == typ
+	}
+	return false
+}
+
+// isLiteralOf reports whether x is a literal, possibly signed, whose
+// default type is the predeclared type typ.
+//
+func isLiteralOf(x ast.Expr, typ string) bool {
+	if u, isUnary := x.(*ast.UnaryExpr); isUnary && (u.Op == token.ADD || u.Op == token.SUB) {
+		x = u.X
+	}
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		kinds := map[string]token.Token{"int": token.INT, "float64": token.FLOAT, "complex128": token.IMAG, "rune": token.CHAR, "string": token.STRING}
+		return kinds[typ] == x.Kind
+	case *ast.Ident:
+		return typ == "bool" && (x.Name == "true" || x.Name == "false")
+	}
+	return false
+}
+
+// exprString returns x as gofmt writes it.
+func (p *printer) exprString(x ast.Expr) string {
+	var buf bytes.Buffer
+	goprinter.Fprint(&buf, p.fset, x)
+	return buf.String()
+}
+
+// condExpr prints the conditions and the values found by condCall or
+// condDecl as the conditional expression "a if c else b", in place of
+// the source ending at end.
+//
+func (p *printer) condExpr(conds, values []ast.Expr, end token.Pos, prec1, depth int) {
+	parens := prec1 > token.LowestPrec
+	if parens {
+		p.print(token.LPAREN)
+	}
+	for i, cond := range conds {
+		p.expr1(values[i], token.LowestPrec+1, depth)
+		p.print(blank, token.IF, blank)
+		p.expr1(cond, token.LowestPrec+1, depth)
+		p.print(blank, token.ELSE, blank)
+	}
+	p.expr1(values[len(values)-1], token.LowestPrec, depth)
+	if parens {
+		p.print(token.RPAREN)
+	}
+	// continue as if the source was printed
+	p.print(end)
+}
+
+// condDecl returns the conditions and the values of the declaration
+// list[i] of a variable without a value if the if statement following
+// it assigns the variable in each of its branches, as iGo lowers
+// "var x T = a if c else b":
+//
+//	var x T
+//	if c {
+//		x = a
+//	} else {
+//		x = b
+//	}
+//
+// The conditions and the values must not refer to the name of the
+// variable, which iGo declares after them. Otherwise condDecl returns
+// nil, nil.
+//
+func (p *printer) condDecl(list []ast.Stmt, i int) (conds, values []ast.Expr) {
+	if i+1 >= len(list) {
+		return nil, nil
+	}
+	s, isDecl := list[i].(*ast.DeclStmt)
+	next, isIf := list[i+1].(*ast.IfStmt)
+	if !isDecl || !isIf {
+		return nil, nil
+	}
+	d, isGen := s.Decl.(*ast.GenDecl)
+	if !isGen || d.Tok != token.VAR || d.Lparen.IsValid() || len(d.Specs) != 1 {
+		return nil, nil
+	}
+	v := d.Specs[0].(*ast.ValueSpec)
+	if len(v.Names) != 1 || v.Type == nil || v.Values != nil ||
+		p.lineFor(next.Pos()) != p.lineFor(s.End())+1 || p.hasComments(s.Pos(), next.End()) {
+		return nil, nil
+	}
+	name := v.Names[0]
+	// assigned returns the value assigned to the variable by the block b
+	assigned := func(b *ast.BlockStmt) ast.Expr {
+		if len(b.List) != 1 {
+			return nil
+		}
+		a, isAssign := b.List[0].(*ast.AssignStmt)
+		if !isAssign || a.Tok != token.ASSIGN || len(a.Lhs) != 1 || len(a.Rhs) != 1 {
+			return nil
+		}
+		if id, isIdent := a.Lhs[0].(*ast.Ident); !isIdent || id.Obj == nil || id.Obj != name.Obj {
+			return nil
+		}
+		return a.Rhs[0]
+	}
+	for {
+		v := assigned(next.Body)
+		if next.Init != nil || v == nil {
+			return nil, nil
+		}
+		conds, values = append(conds, next.Cond), append(values, v)
+		if elseIf, isIf := next.Else.(*ast.IfStmt); isIf {
+			next = elseIf
+			continue
+		}
+		b, isBlock := next.Else.(*ast.BlockStmt)
+		if !isBlock {
+			return nil, nil
+		}
+		if v = assigned(b); v == nil {
+			return nil, nil
+		}
+		values = append(values, v)
+		break
+	}
+	for _, x := range append(conds, values...) {
+		if refersTo(x, name.Name) {
+			return nil, nil
+		}
+	}
+	return conds, values
+}
+
+// condDeclStmt prints the declaration s and the if statement next, for
+// which condDecl holds, as a declaration with a conditional value.
+//
+func (p *printer) condDeclStmt(s *ast.DeclStmt, next *ast.IfStmt, conds, values []ast.Expr) {
+	d := s.Decl.(*ast.GenDecl)
+	v := d.Specs[0].(*ast.ValueSpec)
+	p.print(d.Pos(), token.VAR, blank)
+	p.expr(v.Names[0])
+	p.print(blank)
+	p.expr(v.Type)
+	p.print(blank, token.ASSIGN, blank)
+	for next.Else != nil {
+		if elseIf, isIf := next.Else.(*ast.IfStmt); isIf {
+			next = elseIf
+			continue
+		}
+		break
+	}
+	p.condExpr(conds, values, next.Else.(*ast.BlockStmt).Rbrace, token.LowestPrec, 1)
+}
+
+// refersTo reports whether x refers to a name spelled name.
+func refersTo(x ast.Expr, name string) bool {
+	found := false
+	ast.Inspect(x, func(n ast.Node) bool {
+		if id, isIdent := n.(*ast.Ident); isIdent && id.Name == name {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// hasComments reports whether there are comments in the source
+// between pos and end.
+func (p *printer) hasComments(pos, end token.Pos) bool {
+	i := sort.Search(len(p.comments), func(i int) bool { return p.comments[i].End() > pos })
+	return i < len(p.comments) && p.comments[i].Pos() < end
+}
+
 // nodeSize determines the size of n in chars after formatting.
 // The result is <= maxSize if the node fits on one line with at
 // most maxSize chars and the formatted output doesn't contain
@@ -1536,7 +2235,7 @@ func (p *printer) distanceFrom(from token.Pos) int {
 func (p *printer) funcDecl(d *ast.FuncDecl) {
 	p.setComment(d.Doc)
 	p.print(d.Pos(), token.FUNC, blank)
-	if d.Recv != nil {
+	if d.Recv != nil && !p.inMethods {
 		p.expr(d.Recv.List[0].Type) // method: print receiver
 		p.print(d.Pos(), ".")
 		if names := d.Recv.List[0].Names; len(names) > 0 {
@@ -1549,11 +2248,16 @@ func (p *printer) funcDecl(d *ast.FuncDecl) {
 		}
 	}
 	p.expr(d.Name)
+	if d.Type.TypeParams != nil {
+		p.parameters(d.Type.TypeParams, funcTParam)
+	}
 	p.signature(d.Type.Params, d.Type.Results)
 	p.inFunc = true
 	p.adjBlock(d.Body)
 	p.inFunc = false
-	p.print(unindent)
+	if !p.inMethods {
+		p.print(unindent)
+	}
 }
 
 func (p *printer) decl(decl ast.Decl) {
@@ -1561,7 +2265,11 @@ func (p *printer) decl(decl ast.Decl) {
 	case *ast.BadDecl:
 		p.print(d.Pos(), "BadDecl")
 	case *ast.GenDecl:
-		p.genDecl(d)
+		if name, typ := implementsAssertion(d); name != nil {
+			p.implementsDecl(d, name, typ)
+		} else {
+			p.genDecl(d)
+		}
 	case *ast.FuncDecl:
 		p.funcDecl(d)
 	default:
@@ -1585,7 +2293,8 @@ func declToken(decl ast.Decl) (tok token.Token) {
 
 func (p *printer) declList(list []ast.Decl) {
 	tok := token.ILLEGAL
-	for _, d := range list {
+	for i := 0; i < len(list); i++ {
+		d := list[i]
 		prev := tok
 		tok = declToken(d)
 		// If the declaration token changed (e.g., from CONST to TYPE)
@@ -1604,8 +2313,206 @@ func (p *printer) declList(list []ast.Decl) {
 			}
 			p.linebreak(p.lineFor(d.Pos()), min, ignore, false)
 		}
-		p.decl(d)
+		if p.Config.Mode&Methods != 0 {
+			if n := methodsRun(list[i:]); n > 1 && p.methodsDecl(list[i:i+n]) {
+				i += n - 1
+				continue
+			}
+		}
+		p.checkedDecl(d)
+	}
+}
+
+// methodsRun returns the number of methods at the start of list that
+// have the same receiver and can be printed in a methods block.
+func methodsRun(list []ast.Decl) int {
+	var key string
+	for i, d := range list {
+		f, ok := d.(*ast.FuncDecl)
+		if !ok {
+			return i
+		}
+		k, ok := recvKey(f)
+		if !ok || i > 0 && k != key {
+			return i
+		}
+		key = k
+	}
+	return len(list)
+}
+
+// recvKey returns a key identifying the receiver of the function d, and
+// whether d is a method that can be printed in a methods block: its
+// receiver type must be a type name, possibly instantiated with type
+// parameter names, or a pointer to one.
+//
+func recvKey(d *ast.FuncDecl) (key string, ok bool) {
+	if d.Recv == nil || len(d.Recv.List) != 1 {
+		return
+	}
+	recv := d.Recv.List[0]
+	if name := recvName(recv); name != nil {
+		key = name.Name
+	}
+	key += " "
+	x := recv.Type
+	if star, isStar := x.(*ast.StarExpr); isStar {
+		key += "*"
+		x = star.X
+	}
+	var params []ast.Expr
+	switch t := x.(type) {
+	case *ast.IndexExpr:
+		x, params = t.X, []ast.Expr{t.Index}
+	case *ast.IndexListExpr:
+		x, params = t.X, t.Indices
+	}
+	typ, isIdent := x.(*ast.Ident)
+	if !isIdent {
+		return
+	}
+	key += typ.Name
+	for i, param := range params {
+		name, isIdent := param.(*ast.Ident)
+		if !isIdent {
+			return
+		}
+		sep := ","
+		if i == 0 {
+			sep = "["
+		}
+		key += sep + name.Name
+	}
+	if len(params) > 0 {
+		key += "]"
+	}
+	return key, true
+}
+
+// recvName returns the name of the receiver recv, or nil if it has none
+// usable in the method body.
+func recvName(recv *ast.Field) *ast.Ident {
+	if len(recv.Names) == 1 && recv.Names[0].Name != "_" {
+		return recv.Names[0]
+	}
+	return nil
+}
+
+// methodsDecl prints the methods in list, which share their receiver,
+// as a methods block and reports whether it parses; if it does not,
+// nothing is printed.
+//
+func (p *printer) methodsDecl(list []ast.Decl) bool {
+	saved := *p
+	saved.wsbuf = append(make([]whiteSpace, 0, cap(p.wsbuf)), p.wsbuf...)
+	first := list[0].(*ast.FuncDecl)
+	recv := first.Recv.List[0]
+	pos := first.Pos()
+	if first.Doc != nil {
+		pos = first.Doc.Pos()
+	}
+	if next := p.posFor(pos); p.commentBefore(next) {
+		p.flush(next, token.FUNC)
+		p.linebreak(next.Line, 1, ignore, false)
+	}
+	// the receiver follows the doc comment of the first method, which
+	// stays with the method
+	offset := p.commentOffset
+	p.commentOffset = infinity
+	p.print(pos, "methods", blank, token.LPAREN)
+	if name := recvName(recv); name != nil {
+		p.expr(name)
+		p.print(blank)
+	}
+	p.expr(recv.Type)
+	p.print(token.RPAREN, indent)
+	p.commentOffset = offset
+	if first.Doc != nil {
+		// continue as if the header was on the line before the comment
+		p.last = p.posFor(pos)
+		p.last.Line--
+	}
+	p.inMethods = true
+	for i, d := range list {
+		min := 1
+		if i > 0 && getDoc(d) != nil {
+			min = 2
+		}
+		p.linebreak(p.lineFor(d.Pos()), min, ignore, false)
+		p.funcDecl(d.(*ast.FuncDecl))
+	}
+	p.inMethods = false
+	p.print(unindent)
+	if parses(p.output[len(saved.output):]) {
+		return true
+	}
+	*p = saved
+	return false
+}
+
+// checkedDecl prints the declaration d, unless the iGo printed for it
+// does not parse: then it prints instead a go! region holding the Go
+// source of d, which to_go copies as is.
+//
+func (p *printer) checkedDecl(d ast.Decl) {
+	saved := *p
+	saved.wsbuf = append(make([]whiteSpace, 0, cap(p.wsbuf)), p.wsbuf...)
+	p.decl(d)
+	if parses(p.output[len(saved.output):]) {
+		return
+	}
+	*p = saved
+	p.verbatimDecl(d)
+}
+
+// parses reports whether out, a piece of printer output, holds complete
+// iGo declarations.
+func parses(out []byte) bool {
+	var buf bytes.Buffer
+	buf.WriteString("package p\n")
+	(&trimmer{output: &buf}).Write(out)
+	buf.WriteByte('\n')
+	_, err := iParser.ParseFile(iToken.NewFileSet(), "", buf.Bytes(), 0)
+	return err == nil
+}
+
+// verbatimDecl prints a go! region holding the Go source of d, as printed
+// by go/printer with the comments inside d and following it on its last
+// line.
+//
+func (p *printer) verbatimDecl(d ast.Decl) {
+	p.print(d.Pos(), "go!", indent)
+
+	var comments []*ast.CommentGroup
+	last := p.lineFor(d.End())
+	for p.commentOffset < infinity && (p.comment.Pos() < d.End() || p.lineFor(p.comment.Pos()) == last) {
+		comments = append(comments, p.comment)
+		p.nextComment()
+	}
+	// the documentation is printed before the region
+	switch x := d.(type) {
+	case *ast.GenDecl:
+		c := *x
+		c.Doc = nil
+		d = &c
+	case *ast.FuncDecl:
+		c := *x
+		c.Doc = nil
+		d = &c
+	}
+	var buf bytes.Buffer
+	file := &ast.File{Name: ast.NewIdent("p"), Decls: []ast.Decl{d}, Comments: comments}
+	cfg := goprinter.Config{Mode: goprinter.UseSpaces | goprinter.TabIndent, Tabwidth: 8}
+	cfg.Fprint(&buf, p.fset, file)
+	src := strings.TrimSpace(strings.TrimPrefix(buf.String(), "package p"))
+
+	for _, line := range strings.Split(src, "\n") {
+		p.print(newline)
+		if line != "" {
+			p.print(line)
+		}
 	}
+	p.print(d.End(), unindent)
 }
 
 func (p *printer) file(src *ast.File) {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
@@ -14,6 +15,7 @@ import (
 	"strings"
 
 	"github.com/DAddYE/igo/cmd"
+	"github.com/DAddYE/igo/token"
 )
 
 type Cmd int
@@ -25,6 +27,7 @@ const (
 	BUILD
 	RUN
 	TEST
+	CHECK
 )
 
 var commands = []string{
@@ -33,6 +36,7 @@ var commands = []string{
 	BUILD:   "build",
 	RUN:     "run",
 	TEST:    "test",
+	CHECK:   "check",
 }
 
 func usage() {
@@ -59,15 +63,18 @@ func abs(i int) int {
 	}
 }
 
-func parseError(err []byte) {
-	const regex = `^(.*):(\d+):(\d+)?\s*(.*)`
+// parseError prints the errors in err which refer to Go files compiled
+// from iGo files at the corresponding iGo positions, and reports whether
+// it found any.
+func parseError(err []byte) (found bool) {
+	const regex = `^(?:vet: )?(.*?):(\d+):(?:(\d+):)?\s*(.*)`
 	re := regexp.MustCompile(regex)
 
 	// Iterate over each error message.
 	for _, line := range bytes.Split(err, []byte{'\n'}) {
 
-		// if the error message is kind of:
-		//		./path/name.go:line:col error message
+		// if the error message is kind of (go vet prefixes it with "vet: "):
+		//		./path/name.go:line:col: error message
 		//
 		match := re.FindAllStringSubmatch(string(line), 4)
 		if len(match) == 1 {
@@ -77,26 +84,82 @@ func parseError(err []byte) {
 			message := match[0][4]
 			igoFile := strings.TrimSuffix(file, ".go") + ".igo"
 			if pos := cmd.IgoPositions[igoFile]; pos != nil {
-				var cols []int
+				found = true
+				// the iGo position printed closest to the Go one
+				at, closest := token.Position{Line: line, Column: col}, -1
 				for in, out := range *pos {
-					if out.Line == line {
-						cols = append(cols, in.Column)
+					if out.Line == line && (closest < 0 || abs(out.Column-col) < closest) {
+						at, closest = in, abs(out.Column-col)
 					}
 				}
-				if len(cols) > 0 {
-					closest := abs(cols[0] - col)
-					for _, c := range cols {
-						if cd := abs(c - col); cd < closest {
-							closest = cd
-						}
-					}
-					fmt.Printf("%s:%d:%d %s\n", igoFile, line, closest, message)
-				} else {
-					fmt.Printf("%s:%d:%d %s\n", igoFile, line, col, message)
-				}
+				fmt.Printf("%s:%d:%d: %s\n", igoFile, at.Line, at.Column, message)
 			}
 		}
 	}
+	return
+}
+
+// goPaths returns the Go paths for the iGo paths: the Go files compiled
+// from the iGo files, and the directories as they are.
+func goPaths(paths []string) []string {
+	if len(paths) == 0 {
+		return []string{"."}
+	}
+	var args []string
+	for _, p := range paths {
+		if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+			args = append(args, p)
+		} else {
+			args = append(args, strings.TrimSuffix(p, ".igo")+".go")
+		}
+	}
+	return args
+}
+
+// check type-checks and vets the Go code compiled from the iGo paths,
+// returning the exit code.
+func check(paths []string) int {
+	gocmd := path.Join(runtime.GOROOT(), "bin", "go")
+	out, err := exec.Command(gocmd, append([]string{"vet"}, goPaths(paths)...)...).CombinedOutput()
+	if err != nil {
+		if !parseError(out) {
+			os.Stderr.Write(out)
+		}
+		return 1
+	}
+	return 0
+}
+
+// run builds the program compiled from the iGo paths and runs it in
+// the terminal, returning its exit code.
+func run(paths []string) int {
+	dir, err := ioutil.TempDir("", "igo-run")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer os.RemoveAll(dir)
+
+	bin := filepath.Join(dir, "main")
+	gocmd := path.Join(runtime.GOROOT(), "bin", "go")
+	out, err := exec.Command(gocmd, append([]string{"build", "-o", bin}, goPaths(paths)...)...).CombinedOutput()
+	if err != nil {
+		if !parseError(out) {
+			os.Stderr.Write(out)
+		}
+		return 1
+	}
+
+	prog := exec.Command(bin)
+	prog.Stdin, prog.Stdout, prog.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := prog.Run(); err != nil {
+		if exit, isExit := err.(*exec.ExitError); isExit {
+			return exit.ExitCode()
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
 }
 
 func main() {
@@ -125,7 +188,7 @@ func main() {
 	case COMPILE:
 		os.Chdir(*cmd.DestDir)
 		exitCode = cmd.To(cmd.GO, paths)
-	case BUILD, RUN, TEST:
+	case BUILD, TEST:
 		os.Chdir(*cmd.DestDir)
 		exitCode = cmd.To(cmd.GO, paths)
 		if exitCode == 0 {
@@ -136,6 +199,18 @@ func main() {
 				exitCode = 1
 			}
 		}
+	case RUN:
+		os.Chdir(*cmd.DestDir)
+		exitCode = cmd.To(cmd.SCRIPT, paths)
+		if exitCode == 0 {
+			exitCode = run(paths)
+		}
+	case CHECK:
+		os.Chdir(*cmd.DestDir)
+		exitCode = cmd.To(cmd.GO, paths)
+		if exitCode == 0 {
+			exitCode = check(paths)
+		}
 	default:
 		fmt.Fprintln(os.Stderr, "Invalid command")
 		usage()
@@ -56,6 +56,10 @@ type parser struct {
 	inDo            bool          // control if we are in a do literal
 	allowEmptyBlock bool          // control if we allowe empty blocks
 
+	// "if" modifier parsed after the last expression of a statement,
+	// held for parsePostfix
+	modifier *ast.PostfixStmt
+
 	// Ordinary identifier scopes
 	pkgScope   *ast.Scope        // pkgScope.Outer == nil
 	topScope   *ast.Scope        // top-most scope; may be pkgScope
@@ -262,7 +266,17 @@ func (p *parser) next0() {
 
 // Consume a comment and return it and the line on which it ends.
 func (p *parser) consumeComment() (comment *ast.Comment, endline int) {
+	// #[-style comments may end on a different line than where they start.
+	// Scan the comment for '\n' chars and adjust endline accordingly.
 	endline = p.file.Line(p.pos)
+	if len(p.lit) > 1 && p.lit[1] == '[' {
+		// don't use range here - no need to decode Unicode code points
+		for i := 0; i < len(p.lit); i++ {
+			if p.lit[i] == '\n' {
+				endline++
+			}
+		}
+	}
 	comment = &ast.Comment{Slash: p.pos, Text: p.lit}
 	p.next0()
 	return
@@ -401,6 +415,11 @@ func (p *parser) expectClosing(tok token.Token, context string) token.Pos {
 }
 
 func (p *parser) expectSemi() {
+	if p.modifier != nil {
+		// a modifier ending a statement which takes none
+		p.modifier = nil
+		p.errorExpected(p.pos, "'else'")
+	}
 	// semicolon is optional before:
 	if p.tok != token.RPAREN && p.tok != token.RBRACE && p.tok != token.DEDENT {
 		switch {
@@ -623,19 +642,58 @@ func (p *parser) parseTypeName() ast.Expr {
 	return ident
 }
 
-func (p *parser) parseArrayType() ast.Expr {
+// packIndexExpr returns an IndexExpr if there is a single index,
+// and an IndexListExpr otherwise.
+func packIndexExpr(x ast.Expr, lbrack token.Pos, list []ast.Expr, rbrack token.Pos) ast.Expr {
+	if len(list) == 1 {
+		return &ast.IndexExpr{X: x, Lbrack: lbrack, Index: list[0], Rbrack: rbrack}
+	}
+	return &ast.IndexListExpr{X: x, Lbrack: lbrack, Indices: list, Rbrack: rbrack}
+}
+
+// parseTypeInstance parses the type arguments instantiating
+// the generic type typ.
+func (p *parser) parseTypeInstance(typ ast.Expr) ast.Expr {
 	if p.trace {
-		defer un(trace(p, "ArrayType"))
+		defer un(trace(p, "TypeInstance"))
 	}
 
 	lbrack := p.expect(token.LBRACK)
-	var len ast.Expr
-	// always permit ellipsis for more fault-tolerant parsing
-	if p.tok == token.ELLIPSIS {
-		len = &ast.Ellipsis{Ellipsis: p.pos}
+	p.exprLev++
+	var list []ast.Expr
+	for p.tok != token.RBRACK && p.tok != token.EOF {
+		list = append(list, p.parseType())
+		if !p.atComma("type argument list") {
+			break
+		}
 		p.next()
-	} else if p.tok != token.RBRACK {
-		len = p.parseRhs()
+	}
+	p.exprLev--
+	rbrack := p.expectClosing(token.RBRACK, "type argument list")
+
+	if len(list) == 0 {
+		p.errorExpected(rbrack, "type argument list")
+		return &ast.BadExpr{From: typ.Pos(), To: rbrack + 1}
+	}
+	return packIndexExpr(typ, lbrack, list, rbrack)
+}
+
+// If len is nil, the array length is parsed, if any.
+func (p *parser) parseArrayType(lbrack token.Pos, len ast.Expr) ast.Expr {
+	if p.trace {
+		defer un(trace(p, "ArrayType"))
+	}
+
+	if len == nil {
+		p.exprLev++
+		// always permit ellipsis for more fault-tolerant parsing
+		if p.tok == token.ELLIPSIS {
+			len = &ast.Ellipsis{Ellipsis: p.pos}
+			p.next()
+		} else if p.tok != token.RBRACK {
+			len = p.parseRhs()
+		}
+		p.exprLev--
 	}
 	p.expect(token.RBRACK)
 	elt := p.parseType()
@@ -643,6 +701,60 @@ func (p *parser) parseArrayType() ast.Expr {
 	return &ast.ArrayType{Lbrack: lbrack, Len: len, Elt: elt}
 }
 
+// parseArrayFieldOrTypeInstance parses what follows the identifier x when
+// it is followed by "[" in a field or parameter list. That is either the
+// array or slice type of a field or parameter named x, as in "x [N]E" or
+// "x []E", in which case it returns x and the type, or the instantiation
+// of the generic type x, as in "x[A]", in which case it returns a nil name
+// and the instantiated type.
+//
+func (p *parser) parseArrayFieldOrTypeInstance(x *ast.Ident) (*ast.Ident, ast.Expr) {
+	if p.trace {
+		defer un(trace(p, "ArrayFieldOrTypeInstance"))
+	}
+
+	lbrack := p.expect(token.LBRACK)
+	var args []ast.Expr
+	if p.tok != token.RBRACK {
+		p.exprLev++
+		if p.tok == token.ELLIPSIS {
+			args = append(args, &ast.Ellipsis{Ellipsis: p.pos})
+			p.next()
+		} else {
+			args = append(args, p.parseRhsOrType())
+		}
+		for p.tok == token.COMMA {
+			p.next()
+			if p.tok == token.RBRACK {
+				break // trailing comma
+			}
+			args = append(args, p.parseRhsOrType())
+		}
+		p.exprLev--
+	}
+
+	if len(args) == 0 {
+		// x []E
+		return x, p.parseArrayType(lbrack, nil)
+	}
+	if len(args) == 1 && p.tok == token.RBRACK {
+		rbrack := p.pos
+		p.next()
+		if elt := p.tryType(); elt != nil {
+			// x [N]E
+			return x, &ast.ArrayType{Lbrack: lbrack, Len: args[0], Elt: elt}
+		}
+		// x[A]
+		p.resolve(x)
+		return nil, packIndexExpr(x, lbrack, args, rbrack)
+	}
+
+	// x[A1, A2, ...]
+	rbrack := p.expectClosing(token.RBRACK, "type argument list")
+	p.resolve(x)
+	return nil, packIndexExpr(x, lbrack, args, rbrack)
+}
+
 func (p *parser) makeIdentList(list []ast.Expr) []*ast.Ident {
 	idents := make([]*ast.Ident, len(list))
 	for i, x := range list {
@@ -789,6 +901,26 @@ func (p *parser) parseVarType(isParam bool) ast.Expr {
 	return typ
 }
 
+// tryVarTypeOrName is like tryVarType, but an identifier followed by "["
+// may also turn out to be the name of a field or parameter followed by
+// its array or slice type: the name is returned together with the type
+// in that case. See parseArrayFieldOrTypeInstance.
+//
+// If the result is an identifier, it is not resolved.
+func (p *parser) tryVarTypeOrName(isParam bool) (*ast.Ident, ast.Expr) {
+	if p.tok != token.IDENT {
+		return nil, p.tryVarType(isParam)
+	}
+	typ := p.parseTypeName()
+	if p.tok == token.LBRACK {
+		if ident, isIdent := typ.(*ast.Ident); isIdent {
+			return p.parseArrayFieldOrTypeInstance(ident)
+		}
+		typ = p.parseTypeInstance(typ)
+	}
+	return nil, typ
+}
+
 // If any of the results are identifiers, they are not resolved.
 func (p *parser) parseVarList(isParam bool) (list []ast.Expr, typ ast.Expr) {
 	if p.trace {
@@ -800,13 +932,25 @@ func (p *parser) parseVarList(isParam bool) (list []ast.Expr, typ ast.Expr) {
 	// parse/tryVarType accepts any type (including parenthesized
 	// ones) even though the syntax does not permit them here: we
 	// accept them all for more robust parsing and complain later
-	for typ := p.parseVarType(isParam); typ != nil; {
-		list = append(list, typ)
+	name, x := p.tryVarTypeOrName(isParam)
+	if x == nil {
+		pos := p.pos
+		p.errorExpected(pos, "type")
+		p.next() // make progress
+		x = &ast.BadExpr{From: pos, To: p.pos}
+	}
+	for x != nil {
+		if name != nil {
+			// the type of the list has been parsed already
+			list = append(list, name)
+			return list, x
+		}
+		list = append(list, x)
 		if p.tok != token.COMMA {
 			break
 		}
 		p.next()
-		typ = p.tryVarType(isParam) // maybe nil as in: func f(int,) {}
+		name, x = p.tryVarTypeOrName(isParam) // maybe nil as in: func f(int,) {}
 	}
 
 	// if we had a list of identifiers, it must be followed by a type
@@ -919,6 +1063,91 @@ func (p *parser) parseFuncType() (*ast.FuncType, *ast.Scope) {
 	return &ast.FuncType{Func: pos, Params: params, Results: results}, scope
 }
 
+// parseTypeParams parses a type parameter list, whose opening bracket
+// lbrack has been consumed already, together with the first parameter
+// names and their constraint typ, if any. The parameters are declared
+// in scope.
+//
+func (p *parser) parseTypeParams(scope *ast.Scope, lbrack token.Pos, names []*ast.Ident, typ ast.Expr) *ast.FieldList {
+	if p.trace {
+		defer un(trace(p, "TypeParams"))
+	}
+
+	p.exprLev++
+	var list []*ast.Field
+	for {
+		if names == nil {
+			names = p.parseIdentList()
+		} else if typ == nil && p.tok == token.COMMA {
+			p.next()
+			names = append(names, p.parseIdentList()...)
+		}
+		if typ == nil {
+			typ = p.embeddedElem(nil)
+		}
+		field := &ast.Field{Names: names, Type: typ}
+		p.declare(field, nil, scope, ast.Typ, names...)
+		list = append(list, field)
+		if !p.atComma("type parameter list") {
+			break
+		}
+		p.next()
+		if p.tok == token.RBRACK {
+			break // trailing comma
+		}
+		names, typ = nil, nil
+	}
+	p.exprLev--
+	rbrack := p.expectClosing(token.RBRACK, "type parameter list")
+
+	return &ast.FieldList{Opening: lbrack, List: list, Closing: rbrack}
+}
+
+// embeddedElem parses a union of terms, as in "~int | ~string", used
+// as a type constraint or embedded in an interface. If x is not nil,
+// it is the first term.
+//
+func (p *parser) embeddedElem(x ast.Expr) ast.Expr {
+	if p.trace {
+		defer un(trace(p, "EmbeddedElem"))
+	}
+
+	if x == nil {
+		x = p.embeddedTerm()
+	}
+	for p.tok == token.OR {
+		pos := p.pos
+		p.next()
+		y := p.embeddedTerm()
+		x = &ast.BinaryExpr{X: x, OpPos: pos, Op: token.OR, Y: y}
+	}
+
+	return x
+}
+
+func (p *parser) embeddedTerm() ast.Expr {
+	if p.trace {
+		defer un(trace(p, "EmbeddedTerm"))
+	}
+
+	if p.tok == token.TILDE {
+		pos := p.pos
+		p.next()
+		typ := p.parseType()
+		return &ast.UnaryExpr{OpPos: pos, Op: token.TILDE, X: typ}
+	}
+
+	typ := p.tryType()
+	if typ == nil {
+		pos := p.pos
+		p.errorExpected(pos, "~ term or type")
+		p.next() // make progress
+		return &ast.BadExpr{From: pos, To: p.pos}
+	}
+
+	return typ
+}
+
 func (p *parser) parseMethodSpec(scope *ast.Scope) *ast.Field {
 	if p.trace {
 		defer un(trace(p, "MethodSpec"))
@@ -927,17 +1156,27 @@ func (p *parser) parseMethodSpec(scope *ast.Scope) *ast.Field {
 	doc := p.leadComment
 	var idents []*ast.Ident
 	var typ ast.Expr
-	x := p.parseTypeName()
-	if ident, isIdent := x.(*ast.Ident); isIdent && p.tok == token.LPAREN {
+	if p.tok != token.IDENT {
+		// type element
+		typ = p.embeddedElem(nil)
+	} else if x := p.parseTypeName(); p.tok == token.LPAREN {
 		// method
+		ident, isIdent := x.(*ast.Ident)
+		if !isIdent {
+			p.errorExpected(x.Pos(), "method name")
+			ident = &ast.Ident{NamePos: x.Pos(), Name: "_"}
+		}
 		idents = []*ast.Ident{ident}
 		scope := ast.NewScope(nil) // method scope
 		params, results := p.parseSignature(scope)
 		typ = &ast.FuncType{Func: token.NoPos, Params: params, Results: results}
 	} else {
-		// embedded interface
-		typ = x
-		p.resolve(typ)
+		// embedded interface or type element
+		if p.tok == token.LBRACK {
+			x = p.parseTypeInstance(x)
+		}
+		p.resolve(x)
+		typ = p.embeddedElem(x)
 	}
 
 	// We can allow it on the same line
@@ -965,7 +1204,7 @@ func (p *parser) parseInterfaceType() *ast.InterfaceType {
 	switch p.tok {
 	case token.COLON:
 		start = p.expect(token.COLON)
-		if p.tok == token.IDENT {
+		if p.tok != token.SEMICOLON && p.tok != token.EOF {
 			list = append(list, p.parseMethodSpec(scope))
 		} else {
 			p.expect(token.IDENT)
@@ -974,7 +1213,7 @@ func (p *parser) parseInterfaceType() *ast.InterfaceType {
 		p.expectSemi()
 		if p.tok == token.INDENT {
 			start = p.expect(token.INDENT)
-			for p.tok == token.IDENT {
+			for p.tok != token.DEDENT && p.tok != token.EOF {
 				list = append(list, p.parseMethodSpec(scope))
 			}
 			end = p.expect(token.DEDENT)
@@ -1039,9 +1278,14 @@ func (p *parser) parseChanType() *ast.ChanType {
 func (p *parser) tryIdentOrType() ast.Expr {
 	switch p.tok {
 	case token.IDENT:
-		return p.parseTypeName()
+		typ := p.parseTypeName()
+		if p.tok == token.LBRACK {
+			typ = p.parseTypeInstance(typ)
+		}
+		return typ
 	case token.LBRACK:
-		return p.parseArrayType()
+		lbrack := p.expect(token.LBRACK)
+		return p.parseArrayType(lbrack, nil)
 	case token.STRUCT:
 		return p.parseStructType()
 	case token.MUL:
@@ -1121,7 +1365,7 @@ func (p *parser) parseBody(scope *ast.Scope) *ast.BlockStmt {
 		switch {
 		case p.tok == token.INDENT:
 			indent := p.expect(token.INDENT)
-			p.openScope()
+			p.topScope = scope // open function scope
 			p.openLabelScope()
 			list := p.parseStmtList()
 			p.closeLabelScope()
@@ -1195,9 +1439,135 @@ func (p *parser) parseFuncTypeOrLit() ast.Expr {
 	return &ast.FuncLit{Type: typ, Body: body}
 }
 
+// isInterpolated reports whether the string literal lit may contain
+// #{...} interpolations or \# escapes.
+//
+func isInterpolated(lit string) bool {
+	return lit[0] == '"' && !strings.HasPrefix(lit, `"""`) &&
+		(strings.Contains(lit, "#{") || strings.Contains(lit, `\#`))
+}
+
+// isFormatVerb reports whether s is a single fmt verb with optional
+// flags, width and precision; e.g. %d, %-8s or %.2f.
+//
+func isFormatVerb(s string) bool {
+	if len(s) < 2 || s[0] != '%' {
+		return false
+	}
+	s = strings.TrimLeft(s[1:], "+-# 0")
+	s = strings.TrimLeft(s, "0123456789")
+	if strings.HasPrefix(s, ".") {
+		s = strings.TrimLeft(s[1:], "0123456789")
+	}
+	return len(s) == 1 && unicode.IsLetter(rune(s[0]))
+}
+
+// interpolationEnd returns the index of the '}' closing the interpolation
+// starting at lit[i:] with "#{", skipping nested braces and literals as
+// the scanner does; or len(lit)-1 (the closing quote) if there is none.
+//
+func interpolationEnd(lit string, i int) int {
+	depth := 0
+	for i += 2; i < len(lit)-1; i++ {
+		switch lit[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case '"', '\'', '`':
+			quote := lit[i]
+			for i++; i < len(lit)-1 && lit[i] != quote; i++ {
+				switch {
+				case lit[i] == '\\' && quote != '`':
+					i++
+				case lit[i] == '#' && lit[i+1] == '{' && quote == '"':
+					i = interpolationEnd(lit, i)
+				}
+			}
+		}
+	}
+	return len(lit) - 1
+}
+
+// parseInterpolatedLit parses a string literal with interpolations. The
+// expression of each #{x} or #{x:%verb} is scanned again from the source,
+// with the scanner restricted to its region, and parsed as any other
+// expression; thus positions, including those of errors, point inside
+// the literal.
+//
+func (p *parser) parseInterpolatedLit() *ast.InterpolatedLit {
+	if p.trace {
+		defer un(trace(p, "InterpolatedLit"))
+	}
+
+	x := &ast.InterpolatedLit{ValuePos: p.pos, Value: p.lit}
+	base := p.file.Offset(p.pos)
+	end := len(x.Value) - 1 // closing quote
+
+	// the scanner and the current token are restored at the end
+	scanner, pos, tok, lit, exprLev := p.scanner, p.pos, p.tok, p.lit, p.exprLev
+
+	for i := 1; i < end; i++ {
+		switch {
+		case x.Value[i] == '\\':
+			i++ // skip escaped character
+			continue
+		case x.Value[i] != '#' || x.Value[i+1] != '{':
+			continue
+		}
+
+		rbrace := interpolationEnd(x.Value, i)
+		e := &ast.Interpolation{Lbrace: x.ValuePos + token.Pos(i), Rbrace: x.ValuePos + token.Pos(rbrace)}
+		if rbrace < end {
+			p.scanner.InitRegion(base+i+2, base+rbrace+1) // include '}'
+		} else {
+			p.scanner.InitRegion(base+i+2, base+end)
+		}
+		p.exprLev = exprLev + 1
+		p.next()
+		e.X = p.parseRhs()
+		switch {
+		case p.tok == token.COLON:
+			// the format verb is taken verbatim up to the closing '}'
+			offs := p.file.Offset(p.pos) - base + 1
+			e.Verb = x.Value[offs:rbrace]
+			if !isFormatVerb(e.Verb) {
+				p.error(x.ValuePos+token.Pos(offs), "invalid format verb "+strconv.Quote(e.Verb))
+			}
+		case p.tok == token.EOF:
+			if rbrace == end {
+				p.error(p.pos, "interpolation not terminated")
+			}
+		case p.tok != token.RBRACE:
+			p.errorExpected(p.pos, "'}'")
+		}
+		x.Exprs = append(x.Exprs, e)
+		i = rbrace
+	}
+
+	p.scanner, p.pos, p.tok, p.lit, p.exprLev = scanner, pos, tok, lit, exprLev
+	p.next()
+
+	return x
+}
+
+// IsMacro reports whether name is the name of a source macro, such
+// as __line__.
+func IsMacro(name string) bool {
+	switch name {
+	case "__filename__", "__fname__", "__line__", "__pkg__":
+		return true
+	}
+	return false
+}
+
 // parseOperand may return an expression or a raw type (incl. array
 // types of the form [...]T. Callers must verify the result.
 // If lhs is set and the result is an identifier, it is not resolved.
+// Source macros are returned as MacroLit nodes.
 //
 func (p *parser) parseOperand(lhs bool) ast.Expr {
 	if p.trace {
@@ -1213,13 +1583,25 @@ again:
 		}
 
 	case token.IDENT:
+		if IsMacro(p.lit) {
+			x := &ast.MacroLit{NamePos: p.pos, Name: p.lit}
+			p.next()
+			return x
+		}
 		x := p.parseIdent()
+		if p.tok == token.NOT {
+			// macro names are not resolved
+			return p.parseMacroExpr(x)
+		}
 		if !lhs {
 			p.resolve(x)
 		}
 		return x
 
 	case token.INT, token.FLOAT, token.IMAG, token.CHAR, token.STRING:
+		if p.tok == token.STRING && isInterpolated(p.lit) {
+			return p.parseInterpolatedLit()
+		}
 		x := &ast.BasicLit{ValuePos: p.pos, Kind: p.tok, Value: p.lit}
 		p.next()
 		return x
@@ -1235,6 +1617,31 @@ again:
 
 	case token.FUNC:
 		return p.parseFuncTypeOrLit()
+
+	case token.LBRACK:
+		// array or slice type, or list comprehension
+		lbrack := p.expect(token.LBRACK)
+		if p.tok == token.RBRACK || p.tok == token.ELLIPSIS {
+			return p.parseArrayType(lbrack, nil)
+		}
+		p.exprLev++
+		x := p.parseRhs()
+		if p.tok != token.FOR {
+			p.exprLev--
+			return p.parseArrayType(lbrack, x)
+		}
+		comp := p.parseComprehension(nil, lbrack, x)
+		p.exprLev--
+		comp.Rbrack = p.expect(token.RBRACK)
+		return comp
+
+	case token.LBRACE:
+		// map comprehension
+		x := p.parseLiteralValue(nil)
+		if _, isComp := x.(*ast.ComprehensionExpr); !isComp {
+			p.error(x.Pos(), "missing type in composite literal")
+		}
+		return x
 	}
 
 	if typ := p.tryIdentOrType(); typ != nil {
@@ -1289,7 +1696,22 @@ func (p *parser) parseIndexOrSlice(x ast.Expr) ast.Expr {
 	var low, high ast.Expr
 	isSlice := false
 	if p.tok != token.COLON {
-		low = p.parseRhs()
+		// the index may be a type argument
+		low = p.parseRhsOrType()
+	}
+	if p.tok == token.COMMA {
+		// instantiation with multiple type arguments
+		list := []ast.Expr{low}
+		for p.tok == token.COMMA {
+			p.next()
+			if p.tok == token.RBRACK {
+				break // trailing comma
+			}
+			list = append(list, p.parseRhsOrType())
+		}
+		p.exprLev--
+		rbrack := p.expectClosing(token.RBRACK, "type argument list")
+		return &ast.IndexListExpr{X: x, Lbrack: lbrack, Indices: list, Rbrack: rbrack}
 	}
 	if p.tok == token.COLON {
 		isSlice = true
@@ -1348,13 +1770,87 @@ func (p *parser) parseCallOrConversion(fun ast.Expr) *ast.CallExpr {
 	return &ast.CallExpr{Fun: fun, Lparen: lparen, Args: list, Ellipsis: ellipsis, Rparen: rparen}
 }
 
-func (p *parser) parseElement(keyOk bool) ast.Expr {
+// parseMacroExpr parses the invocation of the macro name, whose name
+// was already consumed: name!(arg, ...), optionally followed by a
+// "do" block.
+//
+func (p *parser) parseMacroExpr(name *ast.Ident) *ast.MacroExpr {
 	if p.trace {
-		defer un(trace(p, "Element"))
+		defer un(trace(p, "MacroExpr"))
 	}
 
-	if p.tok == token.LBRACE {
-		return p.parseLiteralValue(nil)
+	bang := p.expect(token.NOT)
+	lparen := p.expect(token.LPAREN)
+	p.exprLev++
+	var list []ast.Node
+	for p.tok != token.RPAREN && p.tok != token.EOF {
+		list = append(list, p.parseMacroArg())
+		if !p.atComma("macro arguments") {
+			break
+		}
+		p.next()
+	}
+	p.exprLev--
+	rparen := p.expectClosing(token.RPAREN, "macro arguments")
+
+	var body *ast.BlockStmt
+	if p.tok == token.DO {
+		p.next()
+		p.exprLev++
+		body = p.parseBlockStmt()
+		p.exprLev--
+	}
+
+	return &ast.MacroExpr{Name: name, Bang: bang, Lparen: lparen, Args: list, Rparen: rparen, Body: body}
+}
+
+// parseMacroArg parses a macro argument: an expression, a type, or a
+// simple statement with a single left-hand side which does not declare
+// variables, such as x++ or x += y.
+//
+func (p *parser) parseMacroArg() ast.Node {
+	if p.trace {
+		defer un(trace(p, "MacroArg"))
+	}
+
+	// an argument may be an assignment: "=" is not read as "=="
+	old := p.inRhs
+	p.inRhs = false
+	x := p.checkExprOrType(p.parseExpr(false))
+	p.inRhs = old
+
+	switch p.tok {
+	case
+		token.ASSIGN, token.ADD_ASSIGN,
+		token.SUB_ASSIGN, token.MUL_ASSIGN, token.QUO_ASSIGN,
+		token.REM_ASSIGN, token.AND_ASSIGN, token.OR_ASSIGN,
+		token.XOR_ASSIGN, token.SHL_ASSIGN, token.SHR_ASSIGN, token.AND_NOT_ASSIGN:
+		pos, tok := p.pos, p.tok
+		p.next()
+		return &ast.AssignStmt{Lhs: []ast.Expr{x}, TokPos: pos, Tok: tok, Rhs: []ast.Expr{p.parseRhs()}}
+
+	case token.INC, token.DEC:
+		s := &ast.IncDecStmt{X: x, TokPos: p.pos, Tok: p.tok}
+		p.next()
+		return s
+
+	case token.ARROW:
+		arrow := p.pos
+		p.next()
+		return &ast.SendStmt{Chan: x, Arrow: arrow, Value: p.parseRhs()}
+
+	case token.DEFINE:
+		p.error(p.pos, "cannot declare in a macro argument")
+		p.next()
+		p.parseRhs()
+		return &ast.BadStmt{From: x.Pos(), To: p.pos}
+	}
+	return x
+}
+
+func (p *parser) parseElement(keyOk bool) ast.Expr {
+	if p.trace {
+		defer un(trace(p, "Element"))
 	}
 
 	// Because the parser doesn't know the composite literal type, it cannot
@@ -1373,7 +1869,13 @@ func (p *parser) parseElement(keyOk bool) ast.Expr {
 	// undeclared; or b) it is a struct field. In the former case, the type
 	// checker can do a top-level lookup, and in the latter case it will do
 	// a separate field lookup.
-	x := p.checkExpr(p.parseExpr(keyOk))
+	var x ast.Expr
+	if p.tok == token.LBRACE {
+		// a composite literal with its type elided, possibly a key
+		x = p.parseLiteralValue(nil)
+	} else {
+		x = p.checkExpr(p.parseExpr(keyOk))
+	}
 	if keyOk {
 		if p.tok == token.COLON {
 			colon := p.pos
@@ -1383,7 +1885,13 @@ func (p *parser) parseElement(keyOk bool) ast.Expr {
 			// we don't get (possibly false) errors about
 			// undeclared names.
 			p.tryResolve(x, false)
-			return &ast.KeyValueExpr{Key: x, Colon: colon, Value: p.parseElement(false)}
+			var value ast.Expr
+			if p.atIndentedValue() {
+				value = p.parseIndentedValue(nil)
+			} else {
+				value = p.parseElement(false)
+			}
+			return &ast.KeyValueExpr{Key: x, Colon: colon, Value: value}
 		}
 		p.resolve(x) // not a key
 	}
@@ -1417,24 +1925,177 @@ func (p *parser) parseLiteralValue(typ ast.Expr) ast.Expr {
 	p.exprLev++
 	if p.tok != token.RBRACE {
 		elts = p.parseElementList()
+		if len(elts) == 1 && p.tok == token.FOR {
+			if _, isKV := elts[0].(*ast.KeyValueExpr); typ == nil && !isKV {
+				p.errorExpected(elts[0].Pos(), "key: value")
+			}
+			comp := p.parseComprehension(typ, lbrace, elts[0])
+			p.exprLev--
+			comp.Rbrack = p.expectClosing(token.RBRACE, "comprehension")
+			return comp
+		}
 	}
 	p.exprLev--
 	rbrace := p.expectClosing(token.RBRACE, "composite literal")
 	return &ast.CompositeLit{Type: typ, Lbrace: lbrace, Elts: elts, Rbrace: rbrace}
 }
 
-// checkExpr checks that x is an expression (and not a type).
-func (p *parser) checkExpr(x ast.Expr) ast.Expr {
-	switch unparen(x).(type) {
-	case *ast.BadExpr:
-	case *ast.Ident:
-	case *ast.BasicLit:
-	case *ast.FuncLit:
+// atIndentedValue reports whether the line ends before an indented block,
+// which holds the elements of a composite literal.
+func (p *parser) atIndentedValue() bool {
+	return p.isIndent() && p.scanner.Peek() == token.INDENT
+}
+
+// parseIndentedValue parses the elements of a composite literal of type
+// typ, or nil, indented below it rather than enclosed in braces:
+//
+//	Point
+//		X: 1
+//		Y: 2
+//
+func (p *parser) parseIndentedValue(typ ast.Expr) *ast.CompositeLit {
+	if p.trace {
+		defer un(trace(p, "IndentedValue"))
+	}
+
+	p.expectSemi()
+	lbrace := p.expect(token.INDENT)
+	var elts []ast.Expr
+	var end token.Pos // last position of the elements
+	for p.tok != token.DEDENT && p.tok != token.EOF {
+		elts = append(elts, p.parseElement(true))
+		for p.tok == token.COMMA {
+			p.next()
+			elts = append(elts, p.parseElement(true))
+		}
+		end = elts[len(elts)-1].End() - 1
+		p.expectSemi()
+	}
+	rbrace := p.expect(token.DEDENT)
+	// the block closes after its last element and the comments in it,
+	// before the blank lines and comments following it
+	for i := len(p.comments) - 1; i >= 0 && end.IsValid(); i-- {
+		if c := p.comments[i]; c.Pos() < rbrace {
+			if c.Pos() > end {
+				end = c.End() - 1
+			}
+			break
+		}
+	}
+	if end.IsValid() && p.file.Line(end) < p.file.Line(rbrace) {
+		rbrace = end
+	}
+	return &ast.CompositeLit{Type: typ, Lbrace: lbrace, Elts: elts, Rbrace: rbrace, Block: true}
+}
+
+// parseComprehension parses the clauses following the element elt of a
+// comprehension of type typ, or nil, opened at lbrack; the caller parses
+// the closing bracket:
+//
+//	for [key,] value in x [if cond]
+//
+func (p *parser) parseComprehension(typ ast.Expr, lbrack token.Pos, elt ast.Expr) *ast.ComprehensionExpr {
+	if p.trace {
+		defer un(trace(p, "Comprehension"))
+	}
+
+	x := &ast.ComprehensionExpr{Type: typ, Lbrack: lbrack, Elt: elt}
+	x.For = p.expect(token.FOR)
+	x.Value = p.parseIdent()
+	if p.tok == token.COMMA {
+		p.next()
+		x.Key, x.Value = x.Value, p.parseIdent()
+	}
+	x.In = p.pos
+	if p.tok == token.IDENT && p.lit == "in" {
+		p.next()
+	} else {
+		p.errorExpected(p.pos, "'in'")
+	}
+	// "if" starts the condition, not a conditional expression
+	old := p.inRhs
+	p.inRhs = true
+	x.X = p.checkExpr(p.parseBinaryExpr(false, token.LowestPrec+1))
+	p.inRhs = old
+
+	// the variables are in scope in the element and the condition
+	p.openScope()
+	if x.Key != nil {
+		p.declare(x, nil, p.topScope, ast.Var, x.Key, x.Value)
+	} else {
+		p.declare(x, nil, p.topScope, ast.Var, x.Value)
+	}
+	p.rebind(elt, p.topScope)
+	if p.tok == token.IF {
+		x.If = p.pos
+		p.next()
+		x.Cond = p.parseRhs()
+	}
+	p.closeScope()
+
+	return x
+}
+
+// rebind resolves the identifiers in x to the objects declared in scope,
+// after x in the source, when they were resolved outside of scope.
+func (p *parser) rebind(x ast.Expr, scope *ast.Scope) {
+	outer := func(name string) *ast.Object {
+		for s := scope.Outer; s != nil; s = s.Outer {
+			if obj := s.Lookup(name); obj != nil {
+				return obj
+			}
+		}
+		return nil
+	}
+	if kv, isKV := x.(*ast.KeyValueExpr); isKV {
+		// a key is only resolved if possible
+		if key, isIdent := kv.Key.(*ast.Ident); isIdent && key.Obj == nil {
+			key.Obj = scope.Lookup(key.Name)
+		}
+	}
+	ast.Inspect(x, func(n ast.Node) bool {
+		ident, isIdent := n.(*ast.Ident)
+		if !isIdent || ident.Obj == nil {
+			return true
+		}
+		obj := scope.Lookup(ident.Name)
+		switch {
+		case obj == nil:
+			// not a variable of scope
+		case ident.Obj == unresolved:
+			for i, u := range p.unresolved {
+				if u == ident {
+					p.unresolved = append(p.unresolved[:i], p.unresolved[i+1:]...)
+					break
+				}
+			}
+			ident.Obj = obj
+		case ident.Obj == outer(ident.Name):
+			ident.Obj = obj
+		}
+		return true
+	})
+}
+
+// checkExpr checks that x is an expression (and not a type).
+func (p *parser) checkExpr(x ast.Expr) ast.Expr {
+	switch unparen(x).(type) {
+	case *ast.BadExpr:
+	case *ast.Ident:
+	case *ast.BasicLit:
+	case *ast.InterpolatedLit:
+	case *ast.MacroLit:
+	case *ast.MacroExpr:
+	case *ast.TryExpr:
+	case *ast.FuncLit:
 	case *ast.CompositeLit:
+	case *ast.ComprehensionExpr:
+	case *ast.CondExpr:
 	case *ast.ParenExpr:
 		panic("unreachable")
 	case *ast.SelectorExpr:
 	case *ast.IndexExpr:
+	case *ast.IndexListExpr:
 	case *ast.SliceExpr:
 	case *ast.TypeAssertExpr:
 		// If t.Type == nil we have a type assertion of the form
@@ -1454,7 +2115,8 @@ func (p *parser) checkExpr(x ast.Expr) ast.Expr {
 	return x
 }
 
-// isTypeName returns true iff x is a (qualified) TypeName.
+// isTypeName returns true iff x is a (qualified) TypeName,
+// possibly instantiated.
 func isTypeName(x ast.Expr) bool {
 	switch t := x.(type) {
 	case *ast.BadExpr:
@@ -1462,6 +2124,10 @@ func isTypeName(x ast.Expr) bool {
 	case *ast.SelectorExpr:
 		_, isIdent := t.X.(*ast.Ident)
 		return isIdent
+	case *ast.IndexExpr:
+		return isTypeName(t.X)
+	case *ast.IndexListExpr:
+		return isTypeName(t.X)
 	default:
 		return false // all other nodes are not type names
 	}
@@ -1476,6 +2142,10 @@ func isLiteralType(x ast.Expr) bool {
 	case *ast.SelectorExpr:
 		_, isIdent := t.X.(*ast.Ident)
 		return isIdent
+	case *ast.IndexExpr:
+		return isTypeName(t.X)
+	case *ast.IndexListExpr:
+		return isTypeName(t.X)
 	case *ast.ArrayType:
 	case *ast.StructType:
 	case *ast.MapType:
@@ -1565,6 +2235,15 @@ L:
 			} else {
 				break L
 			}
+		case token.SEMICOLON:
+			if p.exprLev >= 0 && isLiteralType(x) && p.atIndentedValue() {
+				if lhs {
+					p.resolve(x)
+				}
+				x = p.parseIndentedValue(x)
+			} else {
+				break L
+			}
 		default:
 			break L
 		}
@@ -1639,6 +2318,17 @@ func (p *parser) parseUnaryExpr(lhs bool) ast.Expr {
 		p.next()
 		x := p.parseUnaryExpr(false)
 		return &ast.StarExpr{Star: pos, X: p.checkExprOrType(x)}
+
+	case token.TRY:
+		pos := p.pos
+		p.next()
+		x := p.parseUnaryExpr(false)
+		if _, isCall := unparen(x).(*ast.CallExpr); !isCall {
+			if _, isBad := x.(*ast.BadExpr); !isBad {
+				p.errorExpected(x.Pos(), "function/method call")
+			}
+		}
+		return &ast.TryExpr{Try: pos, X: x}
 	}
 
 	return p.parsePrimaryExpr(lhs)
@@ -1687,7 +2377,50 @@ func (p *parser) parseExpr(lhs bool) ast.Expr {
 		defer un(trace(p, "Expression"))
 	}
 
-	return p.parseBinaryExpr(lhs, token.LowestPrec+1)
+	x := p.parseBinaryExpr(lhs, token.LowestPrec+1)
+	if p.tok == token.IF && p.modifier == nil && p.ptok != token.DEDENT && p.ptok != token.COMMENT {
+		return p.parseCondExpr(x, lhs)
+	}
+	return x
+}
+
+// parseCondExpr parses the conditional expression whose value is x if
+// its condition holds:
+//
+//	x if cond else y
+//
+// An "if" without "else" ending the statement is the modifier of the
+// statement instead, which is held for parsePostfix.
+//
+func (p *parser) parseCondExpr(x ast.Expr, lhs bool) ast.Expr {
+	if p.trace {
+		defer un(trace(p, "CondExpr"))
+	}
+
+	pos := p.pos
+	p.next()
+	old := p.inRhs
+	p.inRhs = true
+	cond := p.checkExpr(p.parseBinaryExpr(false, token.LowestPrec+1))
+	p.inRhs = old
+	if p.tok != token.ELSE && (p.tok == token.SEMICOLON || p.tok == token.DEDENT || p.tok == token.EOF || p.ptok == token.COMMENT) {
+		p.modifier = &ast.PostfixStmt{TokPos: pos, Tok: token.IF, Cond: cond}
+		return x
+	}
+	if lhs {
+		p.resolve(x)
+	}
+	els := p.pos
+	var y ast.Expr
+	if p.tok == token.ELSE {
+		p.next()
+		y = p.checkExpr(p.parseExpr(false))
+	} else {
+		p.errorExpected(els, "'else'")
+		y = &ast.BadExpr{From: els, To: els}
+	}
+
+	return &ast.CondExpr{X: p.checkExpr(x), If: pos, Cond: cond, Else: els, Y: y}
 }
 
 func (p *parser) parseRhs() ast.Expr {
@@ -1810,19 +2543,53 @@ func (p *parser) parseCallExpr() *ast.CallExpr {
 	return nil
 }
 
+// isBodyStart reports whether a go or defer statement is followed by a
+// body rather than by a call.
+func (p *parser) isBodyStart() bool {
+	return p.tok == token.COLON || p.tok == token.SEMICOLON && p.lit == "\n"
+}
+
+// parseBodyCall parses the body of the go or defer statement at pos as
+// the call of a function literal without parameters, as in
+//
+//	defer
+//		mu.Unlock()
+//		log.Print("done")
+//
+// The "func" keyword of the literal is positioned at pos.
+//
+func (p *parser) parseBodyCall(pos token.Pos) *ast.CallExpr {
+	if p.trace {
+		defer un(trace(p, "BodyCall"))
+	}
+
+	scope := ast.NewScope(p.topScope) // function scope
+	typ := &ast.FuncType{Func: pos, Params: &ast.FieldList{Opening: pos, Closing: pos}}
+	body := p.parseBody(scope)
+
+	return &ast.CallExpr{Fun: &ast.FuncLit{Type: typ, Body: body}, Lparen: body.Closing, Rparen: body.Closing}
+}
+
 func (p *parser) parseGoStmt() ast.Stmt {
 	if p.trace {
 		defer un(trace(p, "GoStmt"))
 	}
 
 	pos := p.expect(token.GO)
+	if p.isBodyStart() {
+		call := p.parseBodyCall(pos)
+		p.expectSemi()
+		return &ast.GoStmt{Go: pos, Call: call}
+	}
 	call := p.parseCallExpr()
-	p.expectSemi()
 	if call == nil {
+		p.expectSemi()
 		return &ast.BadStmt{From: pos, To: pos + 2} // len("go")
 	}
+	s := p.parsePostfix(&ast.GoStmt{Go: pos, Call: call})
+	p.expectSemi()
 
-	return &ast.GoStmt{Go: pos, Call: call}
+	return s
 }
 
 func (p *parser) parseDeferStmt() ast.Stmt {
@@ -1831,16 +2598,23 @@ func (p *parser) parseDeferStmt() ast.Stmt {
 	}
 
 	pos := p.expect(token.DEFER)
+	if p.isBodyStart() {
+		call := p.parseBodyCall(pos)
+		p.expectSemi()
+		return &ast.DeferStmt{Defer: pos, Call: call}
+	}
 	call := p.parseCallExpr()
-	p.expectSemi()
 	if call == nil {
+		p.expectSemi()
 		return &ast.BadStmt{From: pos, To: pos + 5} // len("defer")
 	}
+	s := p.parsePostfix(&ast.DeferStmt{Defer: pos, Call: call})
+	p.expectSemi()
 
-	return &ast.DeferStmt{Defer: pos, Call: call}
+	return s
 }
 
-func (p *parser) parseReturnStmt() *ast.ReturnStmt {
+func (p *parser) parseReturnStmt() ast.Stmt {
 	if p.trace {
 		defer un(trace(p, "ReturnStmt"))
 	}
@@ -1848,15 +2622,16 @@ func (p *parser) parseReturnStmt() *ast.ReturnStmt {
 	pos := p.pos
 	p.expect(token.RETURN)
 	var x []ast.Expr
-	if p.tok != token.SEMICOLON && p.tok != token.DEDENT {
+	if p.tok != token.SEMICOLON && p.tok != token.DEDENT && !isModifier(p.tok) {
 		x = p.parseRhsList()
 	}
+	s := p.parsePostfix(&ast.ReturnStmt{Return: pos, Results: x})
 	p.expectSemi()
 
-	return &ast.ReturnStmt{Return: pos, Results: x}
+	return s
 }
 
-func (p *parser) parseBranchStmt(tok token.Token) *ast.BranchStmt {
+func (p *parser) parseBranchStmt(tok token.Token) ast.Stmt {
 	if p.trace {
 		defer un(trace(p, "BranchStmt"))
 	}
@@ -1869,9 +2644,42 @@ func (p *parser) parseBranchStmt(tok token.Token) *ast.BranchStmt {
 		n := len(p.targetStack) - 1
 		p.targetStack[n] = append(p.targetStack[n], label)
 	}
+	s := p.parsePostfix(&ast.BranchStmt{TokPos: pos, Tok: tok, Label: label})
 	p.expectSemi()
 
-	return &ast.BranchStmt{TokPos: pos, Tok: tok, Label: label}
+	return s
+}
+
+func isModifier(tok token.Token) bool {
+	return tok == token.IF || tok == token.UNLESS
+}
+
+// parsePostfix parses the modifier following the statement s, if any,
+// as in "s if cond" or "s unless cond".
+func (p *parser) parsePostfix(s ast.Stmt) ast.Stmt {
+	m := p.modifier
+	if m == nil && (!isModifier(p.tok) || p.ptok == token.DEDENT || p.ptok == token.COMMENT) {
+		// not a modifier: s is terminated, as by expectSemi
+		return s
+	}
+	if p.trace {
+		defer un(trace(p, "PostfixStmt"))
+	}
+
+	if a, isAssign := s.(*ast.AssignStmt); isAssign && a.Tok == token.DEFINE {
+		p.error(a.TokPos, "cannot declare in a statement with a modifier")
+	}
+	if m != nil {
+		// parsed with the last expression of s
+		p.modifier = nil
+		m.Stmt = s
+		return m
+	}
+	pos, tok := p.pos, p.tok
+	p.next()
+	cond := p.parseRhs()
+
+	return &ast.PostfixStmt{Stmt: s, TokPos: pos, Tok: tok, Cond: cond}
 }
 
 func (p *parser) makeExpr(s ast.Stmt) ast.Expr {
@@ -2141,7 +2949,14 @@ func (p *parser) parseForStmt() ast.Stmt {
 	if !p.isIndent() && p.tok != token.COLON {
 		prevLev := p.exprLev
 		p.exprLev = -1
-		if p.tok != token.SEMICOLON {
+		if p.tok == token.RANGE {
+			// "for range x" (nil lhs in assignment)
+			pos := p.pos
+			p.next()
+			y := []ast.Expr{&ast.UnaryExpr{OpPos: pos, Op: token.RANGE, X: p.parseRhs()}}
+			s2 = &ast.AssignStmt{Rhs: y}
+			isRange = true
+		} else if p.tok != token.SEMICOLON {
 			s2, isRange = p.parseSimpleStmt(rangeOk)
 		}
 		if !isRange && p.tok == token.SEMICOLON && !p.isIndent() {
@@ -2167,6 +2982,8 @@ func (p *parser) parseForStmt() ast.Stmt {
 		// check lhs
 		var key, value ast.Expr
 		switch len(as.Lhs) {
+		case 0:
+			// nothing to do
 		case 2:
 			key, value = as.Lhs[0], as.Lhs[1]
 		case 1:
@@ -2211,8 +3028,9 @@ func (p *parser) parseSmallStmt() (s ast.Stmt) {
 		// tokens that may start an expression
 		token.IDENT, token.INT, token.FLOAT, token.IMAG, token.CHAR, token.STRING, token.FUNC, token.LPAREN, // operands
 		token.LBRACK, token.STRUCT, // composite types
-		token.ADD, token.SUB, token.MUL, token.AND, token.XOR, token.ARROW, token.NOT: // unary operators
+		token.ADD, token.SUB, token.MUL, token.AND, token.XOR, token.ARROW, token.NOT, token.TRY: // unary operators
 		s, _ = p.parseSimpleStmt(basic)
+		s = p.parsePostfix(s)
 	case token.RETURN:
 		s = p.parseReturnStmt()
 	case token.BREAK, token.CONTINUE, token.GOTO, token.FALLTHROUGH:
@@ -2243,12 +3061,13 @@ func (p *parser) parseStmt() (s ast.Stmt) {
 		// tokens that may start an expression
 		token.IDENT, token.INT, token.FLOAT, token.IMAG, token.CHAR, token.STRING, token.FUNC, token.LPAREN, // operands
 		token.LBRACK, token.STRUCT, // composite types
-		token.ADD, token.SUB, token.MUL, token.AND, token.XOR, token.ARROW, token.NOT: // unary operators
+		token.ADD, token.SUB, token.MUL, token.AND, token.XOR, token.ARROW, token.NOT, token.TRY: // unary operators
 		s, _ = p.parseSimpleStmt(labelOk)
 		// because of the required look-ahead, labeled statements are
 		// parsed by parseSimpleStmt - don't expect a semicolon after
 		// them
 		if _, isLabeledStmt := s.(*ast.LabeledStmt); !isLabeledStmt {
+			s = p.parsePostfix(s)
 			p.expectSemi()
 		}
 	case token.GO:
@@ -2282,6 +3101,12 @@ func (p *parser) parseStmt() (s ast.Stmt) {
 	case token.DEDENT:
 		// a semicolon may be omitted before a closing "DEDENT"
 		s = &ast.EmptyStmt{Semicolon: p.pos}
+	case token.VERBATIM:
+		pos := p.pos
+		p.error(pos, "go! regions must be declarations")
+		p.next()
+		p.expectSemi()
+		s = &ast.BadStmt{From: pos, To: p.pos}
 	default:
 		// no statement found
 		pos := p.pos
@@ -2384,12 +3209,34 @@ func (p *parser) parseValueSpec(doc *ast.CommentGroup, keyword token.Token, iota
 	return spec
 }
 
+// extractName splits the expression x, parsed as the length of an array
+// type in a type declaration, into the name of a type parameter and its
+// constraint, if any. An expression of the form "P *C" is taken as such
+// only if force is set, that is if it is followed by a comma.
+//
+func extractName(x ast.Expr, force bool) (*ast.Ident, ast.Expr) {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x, nil
+	case *ast.BinaryExpr:
+		if name, isIdent := x.X.(*ast.Ident); isIdent && x.Op == token.MUL && force {
+			// name was resolved as an operand: use a fresh identifier
+			name = &ast.Ident{NamePos: name.NamePos, Name: name.Name}
+			return name, &ast.StarExpr{Star: x.OpPos, X: x.Y}
+		}
+	}
+	return nil, nil
+}
+
 func (p *parser) parseTypeSpec(doc *ast.CommentGroup, _ token.Token, _ int) ast.Spec {
 	if p.trace {
 		defer un(trace(p, "TypeSpec"))
 	}
 
 	ident := p.parseIdent()
+	if p.tok == token.IMPLEMENTS {
+		return p.parseImplementsSpec(doc, ident)
+	}
 
 	// Go spec: The scope of a type identifier declared inside a function begins
 	// at the identifier in the TypeSpec and ends at the end of the innermost
@@ -2398,7 +3245,57 @@ func (p *parser) parseTypeSpec(doc *ast.CommentGroup, _ token.Token, _ int) ast.
 	spec := &ast.TypeSpec{Doc: doc, Name: ident}
 	p.declare(spec, nil, p.topScope, ast.Typ, ident)
 
-	spec.Type = p.parseType()
+	if p.tok == token.LBRACK {
+		// "type T[P C] ..." or "type T [N]E"
+		lbrack := p.expect(token.LBRACK)
+		if p.tok == token.IDENT {
+			x := p.parseExpr(true)
+			if name, typ := extractName(x, p.tok == token.COMMA); name != nil && (typ != nil || p.tok != token.RBRACK) {
+				// the type parameters are in scope in the type
+				p.openScope()
+				spec.TypeParams = p.parseTypeParams(p.topScope, lbrack, []*ast.Ident{name}, typ)
+				if p.tok == token.ASSIGN {
+					// generic type alias
+					spec.Assign = p.pos
+					p.next()
+				}
+				spec.Type = p.parseType()
+				p.closeScope()
+			} else {
+				p.resolve(x)
+				spec.Type = p.parseArrayType(lbrack, p.checkExpr(x))
+			}
+		} else {
+			spec.Type = p.parseArrayType(lbrack, nil)
+		}
+	} else {
+		if p.tok == token.ASSIGN {
+			// type alias
+			spec.Assign = p.pos
+			p.next()
+		}
+		spec.Type = p.parseType()
+	}
+	p.expectSemi() // call before accessing p.linecomment
+	spec.Comment = p.lineComment
+
+	return spec
+}
+
+// parseImplementsSpec parses the rest of a type spec "T implements I, J",
+// which declares that the type named ident implements the interfaces.
+func (p *parser) parseImplementsSpec(doc *ast.CommentGroup, ident *ast.Ident) *ast.ImplementsSpec {
+	if p.trace {
+		defer un(trace(p, "ImplementsSpec"))
+	}
+
+	p.resolve(ident)
+	spec := &ast.ImplementsSpec{Doc: doc, Name: ident, Implements: p.expect(token.IMPLEMENTS)}
+	spec.Types = append(spec.Types, p.parseType())
+	for p.tok == token.COMMA {
+		p.next()
+		spec.Types = append(spec.Types, p.parseType())
+	}
 	p.expectSemi() // call before accessing p.linecomment
 	spec.Comment = p.lineComment
 
@@ -2435,12 +3332,16 @@ func (p *parser) parseGenDecl(keyword token.Token, f parseSpecFunction) *ast.Gen
 	}
 }
 
-func (p *parser) parseReceiver(typ ast.Expr, scope *ast.Scope) *ast.Field {
+// parseReceiver returns the receiver of type typ named ident, or self if
+// ident is nil, declared in scope.
+func (p *parser) parseReceiver(ident *ast.Ident, typ ast.Expr, scope *ast.Scope) *ast.Field {
 	if p.trace {
 		defer un(trace(p, "Receiver"))
 	}
 
-	ident := &ast.Ident{Name: "self"}
+	if ident == nil {
+		ident = &ast.Ident{Name: "self"}
+	}
 	field := &ast.Field{Names: []*ast.Ident{ident}, Type: typ}
 
 	p.declare(field, nil, scope, ast.Var, ident)
@@ -2451,7 +3352,22 @@ func (p *parser) parseReceiver(typ ast.Expr, scope *ast.Scope) *ast.Field {
 	return field
 }
 
-func (p *parser) parseFuncDecl() *ast.FuncDecl {
+// recvTypeParams returns the generic receiver type typ instantiated with
+// its type parameters names, which are declared in scope.
+func (p *parser) recvTypeParams(typ ast.Expr, lbrack token.Pos, names []*ast.Ident, rbrack token.Pos, scope *ast.Scope) ast.Expr {
+	list := make([]ast.Expr, len(names))
+	for i, name := range names {
+		list[i] = name
+	}
+	p.declare(nil, nil, scope, ast.Typ, names...)
+	return packIndexExpr(typ, lbrack, list, rbrack)
+}
+
+// parseFuncDecl parses a function or method declaration. Inside a
+// methods block, group returns the receiver of the block, declared in
+// the scope of the method.
+//
+func (p *parser) parseFuncDecl(group func(*ast.Scope) *ast.FieldList) *ast.FuncDecl {
 	if p.trace {
 		defer un(trace(p, "FunctionDecl"))
 	}
@@ -2464,21 +3380,53 @@ func (p *parser) parseFuncDecl() *ast.FuncDecl {
 	var ident *ast.Ident
 	var recvList *ast.FieldList
 
+	var tparams *ast.FieldList
+
 	lparen := p.pos
 
-	// *T.ident
-	if p.tok == token.MUL {
+	if group != nil {
+		// method of a methods block
+		recvList = group(scope)
+		ident = p.parseIdent()
+	} else if p.tok == token.MUL {
+		// *T.ident or *T[P].ident
 		star := p.expect(token.MUL)
-		typ := p.parseIdent()
+		var typ ast.Expr = p.parseIdent()
+		if p.tok == token.LBRACK {
+			lbrack := p.expect(token.LBRACK)
+			names := p.parseIdentList()
+			rbrack := p.expect(token.RBRACK)
+			typ = p.recvTypeParams(typ, lbrack, names, rbrack, scope)
+		}
 		expr := &ast.StarExpr{Star: star, X: typ}
-		recv = p.parseReceiver(expr, scope)
+		recv = p.parseReceiver(nil, expr, scope)
 		p.expect(token.PERIOD)
 		ident = p.parseIdent()
 	} else {
 		ident = p.parseIdent()
-		// T.ident
-		if p.tok == token.PERIOD {
-			recv = p.parseReceiver(ident, scope) // ident is T here
+		if p.tok == token.LBRACK {
+			// T[P].ident or ident[P C]
+			lbrack := p.expect(token.LBRACK)
+			names := p.parseIdentList()
+			if p.tok == token.RBRACK {
+				rbrack := p.expect(token.RBRACK)
+				if p.tok == token.PERIOD {
+					typ := p.recvTypeParams(ident, lbrack, names, rbrack, scope)
+					recv = p.parseReceiver(nil, typ, scope)
+					p.next()
+					ident = p.parseIdent()
+				} else {
+					p.errorExpected(rbrack, "type constraint")
+					field := &ast.Field{Names: names, Type: &ast.BadExpr{From: rbrack, To: rbrack}}
+					p.declare(field, nil, scope, ast.Typ, names...)
+					tparams = &ast.FieldList{Opening: lbrack, List: []*ast.Field{field}, Closing: rbrack}
+				}
+			} else {
+				tparams = p.parseTypeParams(scope, lbrack, names, nil)
+			}
+		} else if p.tok == token.PERIOD {
+			// T.ident
+			recv = p.parseReceiver(nil, ident, scope) // ident is T here
 			p.next()
 			ident = p.parseIdent()
 		}
@@ -2500,13 +3448,14 @@ func (p *parser) parseFuncDecl() *ast.FuncDecl {
 		Recv: recvList,
 		Name: ident,
 		Type: &ast.FuncType{
-			Func:    pos,
-			Params:  params,
-			Results: results,
+			Func:       pos,
+			TypeParams: tparams,
+			Params:     params,
+			Results:    results,
 		},
 		Body: body,
 	}
-	if recv == nil {
+	if recvList == nil {
 		// Go spec: The scope of an identifier denoting a constant, type,
 		// variable, or function (but not method) declared at top level
 		// (outside any function) is the package block.
@@ -2521,6 +3470,230 @@ func (p *parser) parseFuncDecl() *ast.FuncDecl {
 	return decl
 }
 
+// parseMethodsDecl parses a methods block: the methods keyword, the
+// receiver of its methods, optionally named, and their indented function
+// declarations, as in
+//
+//	methods (s *Server)
+//		func Addr() string
+//			return s.addr
+//
+func (p *parser) parseMethodsDecl() *ast.MethodsDecl {
+	if p.trace {
+		defer un(trace(p, "MethodsDecl"))
+	}
+
+	doc := p.leadComment
+	pos := p.expect(token.METHODS)
+	lparen := p.expect(token.LPAREN)
+	var name, typ *ast.Ident
+	if p.tok == token.IDENT {
+		typ = p.parseIdent()
+		if p.tok != token.RPAREN && p.tok != token.LBRACK {
+			name, typ = typ, nil
+		}
+	}
+	var star token.Pos
+	if typ == nil {
+		if p.tok == token.MUL {
+			star = p.pos
+			p.next()
+		}
+		typ = p.parseIdent()
+	}
+	var lbrack, rbrack token.Pos
+	var tparams []*ast.Ident
+	if p.tok == token.LBRACK {
+		lbrack = p.pos
+		p.next()
+		tparams = p.parseIdentList()
+		rbrack = p.expect(token.RBRACK)
+	}
+	rparen := p.expect(token.RPAREN)
+	p.expectSemi()
+
+	// each method has its own copy of the receiver
+	group := func(scope *ast.Scope) *ast.FieldList {
+		var x ast.Expr = &ast.Ident{NamePos: typ.NamePos, Name: typ.Name}
+		if tparams != nil {
+			names := make([]*ast.Ident, len(tparams))
+			for i, n := range tparams {
+				names[i] = &ast.Ident{NamePos: n.NamePos, Name: n.Name}
+			}
+			x = p.recvTypeParams(x, lbrack, names, rbrack, scope)
+		}
+		if star.IsValid() {
+			x = &ast.StarExpr{Star: star, X: x}
+		}
+		var ident *ast.Ident
+		if name != nil {
+			ident = &ast.Ident{NamePos: name.NamePos, Name: name.Name}
+		}
+		recv := p.parseReceiver(ident, x, scope)
+		return &ast.FieldList{Opening: lparen, List: []*ast.Field{recv}, Closing: rparen}
+	}
+
+	decl := &ast.MethodsDecl{Doc: doc, Methods: pos, Recv: group(ast.NewScope(nil))}
+	decl.Indent = p.expect(token.INDENT)
+	for p.tok != token.DEDENT && p.tok != token.EOF {
+		if p.tok == token.FUNC {
+			decl.List = append(decl.List, p.parseFuncDecl(group))
+			continue
+		}
+		p.errorExpected(p.pos, "method declaration")
+		// skip to the next method
+		for depth := 0; p.tok != token.EOF && (depth > 0 || p.tok != token.FUNC && p.tok != token.DEDENT); p.next() {
+			switch p.tok {
+			case token.INDENT:
+				depth++
+			case token.DEDENT:
+				depth--
+			}
+		}
+	}
+	decl.Dedent = p.expect(token.DEDENT)
+
+	return decl
+}
+
+// parseMacroParams parses the parameters of a macro declaration, each
+// identifier list followed by a kind: expr, stmt or type.
+//
+func (p *parser) parseMacroParams(scope *ast.Scope) *ast.FieldList {
+	if p.trace {
+		defer un(trace(p, "MacroParams"))
+	}
+
+	var list []*ast.Field
+	lparen := p.expect(token.LPAREN)
+	for p.tok != token.RPAREN && p.tok != token.EOF {
+		names := p.parseIdentList()
+		kind := &ast.Ident{NamePos: p.pos, Name: p.lit}
+		switch {
+		case p.tok == token.TYPE:
+			kind.Name = "type"
+			p.next()
+		case p.tok == token.IDENT && (p.lit == "expr" || p.lit == "stmt"):
+			p.next()
+		default:
+			p.errorExpected(p.pos, "expr, stmt or type")
+		}
+		field := &ast.Field{Names: names, Type: kind}
+		p.declare(field, nil, scope, ast.Var, names...)
+		list = append(list, field)
+		if !p.atComma("macro parameters") {
+			break
+		}
+		p.next()
+	}
+	rparen := p.expect(token.RPAREN)
+
+	return &ast.FieldList{Opening: lparen, List: list, Closing: rparen}
+}
+
+// parseMacroDecl parses a macro declaration: the macro keyword, its
+// name, its parameters with their kinds and its body, as in
+//
+//	macro wrap(call, what expr)
+//		if err := call; err != nil
+//			return fmt.Errorf("#{what}: %v", err)
+//
+func (p *parser) parseMacroDecl() *ast.MacroDecl {
+	if p.trace {
+		defer un(trace(p, "MacroDecl"))
+	}
+
+	doc := p.leadComment
+	pos := p.expect(token.MACRO)
+	ident := p.parseIdent()
+	scope := ast.NewScope(p.topScope) // macro scope
+
+	params := p.parseMacroParams(scope)
+	body := p.parseBody(scope)
+
+	return &ast.MacroDecl{Doc: doc, Macro: pos, Name: ident, Params: params, Body: body}
+}
+
+// parseEnumDecl parses an enum declaration: the enum keyword, its name,
+// an optional underlying type and its indented members, as in
+//
+//	enum Weekday uint8
+//		Monday = 1
+//		Tuesday
+//		Wednesday
+//
+func (p *parser) parseEnumDecl() *ast.EnumDecl {
+	if p.trace {
+		defer un(trace(p, "EnumDecl"))
+	}
+
+	doc := p.leadComment
+	pos := p.expect(token.ENUM)
+	ident := p.parseIdent()
+	decl := &ast.EnumDecl{Doc: doc, Enum: pos, Name: ident}
+	p.declare(decl, nil, p.topScope, ast.Typ, ident)
+
+	if p.tok != token.SEMICOLON {
+		decl.Type = p.parseType()
+	}
+	p.expectSemi()
+
+	decl.Indent = p.expect(token.INDENT)
+	for iota := 0; p.tok != token.DEDENT && p.tok != token.EOF; iota++ {
+		decl.Members = append(decl.Members, p.parseEnumMember(p.leadComment, iota))
+	}
+	decl.Dedent = p.expect(token.DEDENT)
+
+	return decl
+}
+
+func (p *parser) parseEnumMember(doc *ast.CommentGroup, iota int) *ast.ValueSpec {
+	if p.trace {
+		defer un(trace(p, "EnumMember"))
+	}
+
+	ident := p.parseIdent()
+	var values []ast.Expr
+	if p.tok == token.ASSIGN {
+		p.next()
+		values = []ast.Expr{p.parseRhs()}
+	}
+	p.expectSemi() // call before accessing p.linecomment
+
+	spec := &ast.ValueSpec{
+		Doc:     doc,
+		Names:   []*ast.Ident{ident},
+		Values:  values,
+		Comment: p.lineComment,
+	}
+	p.declare(spec, iota, p.topScope, ast.Con, ident)
+
+	return spec
+}
+
+// parseVerbatimDecl parses a go! region, whose Go source lines are
+// scanned as a single token, as in
+//
+//	go!
+//		func sum(xs ...int) (n int) {
+//			for _, x := range xs {
+//				n += x
+//			}
+//			return
+//		}
+//
+func (p *parser) parseVerbatimDecl() *ast.VerbatimDecl {
+	if p.trace {
+		defer un(trace(p, "VerbatimDecl"))
+	}
+
+	decl := &ast.VerbatimDecl{Doc: p.leadComment, Go: p.pos, Text: p.lit}
+	p.expect(token.VERBATIM)
+	p.expectSemi()
+
+	return decl
+}
+
 func (p *parser) parseDecl(sync func(*parser)) ast.Decl {
 	if p.trace {
 		defer un(trace(p, "Declaration"))
@@ -2535,7 +3708,19 @@ func (p *parser) parseDecl(sync func(*parser)) ast.Decl {
 		f = p.parseTypeSpec
 
 	case token.FUNC:
-		return p.parseFuncDecl()
+		return p.parseFuncDecl(nil)
+
+	case token.METHODS:
+		return p.parseMethodsDecl()
+
+	case token.MACRO:
+		return p.parseMacroDecl()
+
+	case token.ENUM:
+		return p.parseEnumDecl()
+
+	case token.VERBATIM:
+		return p.parseVerbatimDecl()
 
 	default:
 		pos := p.pos
@@ -2610,7 +3795,7 @@ func (p *parser) parseFile() *ast.File {
 		}
 	}
 
-	return &ast.File{
+	f := &ast.File{
 		Doc:        doc,
 		Package:    pos,
 		Name:       ident,
@@ -2620,4 +3805,142 @@ func (p *parser) parseFile() *ast.File {
 		Unresolved: p.unresolved[0:i],
 		Comments:   p.comments,
 	}
+	if p.mode&PackageClauseOnly == 0 {
+		p.attachDirectives(f)
+	}
+	return f
+}
+
+// ----------------------------------------------------------------------------
+// Directives
+
+// attachDirectives attaches the directives to the Go tool chain in the
+// comments of f to the nodes they apply to, and reports the directives
+// placed where the tool chain would ignore them.
+//
+func (p *parser) attachDirectives(f *ast.File) {
+	for _, g := range f.Comments {
+		for _, c := range g.List {
+			switch c.Directive() {
+			case "go:build", "+build":
+				switch {
+				case c.Pos() > f.Package:
+					p.error(c.Pos(), "misplaced build constraint: must precede the package clause")
+				case g == f.Doc:
+					p.error(c.Pos(), "build constraint must be followed by a blank line")
+				default:
+					f.Build = append(f.Build, c)
+				}
+			case "go:generate":
+				if p.file.Position(c.Pos()).Column != 1 {
+					p.error(c.Pos(), "misplaced #go:generate: must start a line at the top level")
+					break
+				}
+				f.Generate = append(f.Generate, c)
+			case "go:embed":
+				if s := p.embedSpec(f, c); s != nil {
+					s.Embed = append(s.Embed, c)
+				}
+			}
+		}
+	}
+
+	for _, d := range f.Decls {
+		d, isGen := d.(*ast.GenDecl)
+		if !isGen || d.Tok != token.IMPORT {
+			continue
+		}
+		for _, s := range d.Specs {
+			s := s.(*ast.ImportSpec)
+			if s.Path == nil || s.Path.Value != `"C"` {
+				continue
+			}
+			if s.Name != nil {
+				p.error(s.Name.Pos(), `cannot rename import "C"`)
+			}
+			// as found by cgo
+			s.Preamble = s.Doc
+			if s.Preamble == nil && len(d.Specs) == 1 {
+				s.Preamble = d.Doc
+			}
+			if s.Preamble == nil {
+				if g := p.detachedPreamble(f, d); g != nil {
+					p.error(g.Pos(), `cgo preamble must immediately precede import "C"`)
+				}
+			}
+		}
+	}
+}
+
+// embedSpec returns the spec of the variable declared after the #go:embed
+// directive c, or reports an error and returns nil. Only blank lines and
+// comments may separate them.
+//
+func (p *parser) embedSpec(f *ast.File, c *ast.Comment) *ast.ValueSpec {
+	var spec *ast.ValueSpec
+	for _, d := range f.Decls {
+		if d.End() <= c.Pos() {
+			continue
+		}
+		if d, isGen := d.(*ast.GenDecl); isGen && d.Tok == token.VAR {
+			if !d.Indent.IsValid() && c.Pos() < d.Pos() {
+				spec = d.Specs[0].(*ast.ValueSpec)
+			}
+			for i, s := range d.Specs {
+				if d.Indent.IsValid() && c.Pos() < s.Pos() && (i == 0 && d.Indent < c.Pos() || i > 0 && d.Specs[i-1].End() <= c.Pos()) {
+					spec = s.(*ast.ValueSpec)
+				}
+			}
+		}
+		break
+	}
+
+	switch {
+	case spec == nil:
+		p.error(c.Pos(), "misplaced #go:embed: must precede a var declaration")
+	case len(spec.Names) > 1:
+		p.error(c.Pos(), "#go:embed cannot apply to multiple vars")
+	case !importsEmbed(f):
+		p.error(c.Pos(), `#go:embed only allowed in files that import "embed"`)
+	default:
+		return spec
+	}
+	return nil
+}
+
+func importsEmbed(f *ast.File) bool {
+	for _, s := range f.Imports {
+		if s.Path != nil && s.Path.Value == `"embed"` {
+			return true
+		}
+	}
+	return false
+}
+
+// detachedPreamble returns the comment group separated by blank lines
+// from the declaration d of import "C" which looks like a cgo preamble,
+// or nil.
+//
+func (p *parser) detachedPreamble(f *ast.File, d *ast.GenDecl) *ast.CommentGroup {
+	var last *ast.CommentGroup
+	for _, g := range f.Comments {
+		if g.End() >= d.Pos() {
+			break
+		}
+		last = g
+	}
+	if last == nil || last.Pos() < f.Name.End() {
+		return nil
+	}
+	for _, prev := range f.Decls {
+		if prev.End() > last.Pos() && prev.Pos() < last.Pos() {
+			return nil // inside a declaration
+		}
+	}
+	for _, c := range last.List {
+		if strings.Contains(c.Text, "#include") || strings.Contains(c.Text, "#cgo ") {
+			return last
+		}
+	}
+	return nil
 }
@@ -0,0 +1,203 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/DAddYE/igo/token"
+)
+
+// A State is a snapshot of the scanner state taken at the beginning of
+// a line while scanning in SnapshotLines mode. Since the state at the
+// beginning of a line depends only on the source before it, and on the
+// first line of code after it if it follows lines holding only comments,
+// a State can be used to resume scanning after the source following it
+// has been edited.
+//
+type State struct {
+	Offset     int   // offset of the first character of the line
+	stack      []int // indentation stack, up to the current index
+	white      []int // white space indenting the indentation levels
+	pendin     int   // pending indents (> 0) or dedents (< 0)
+	level      int   // parentheses nesting level
+	noSemi     bool
+	unfinished bool
+}
+
+// Equal reports whether scanning from st and from t produces the same
+// tokens and errors, given that the source following both offsets is the
+// same. The white space of the levels does not change the tokens, but it
+// is compared too: the inconsistent indentation errors report it, and
+// levels of the same width may be indented with tabs or with spaces.
+//
+func (st *State) Equal(t *State) bool {
+	if st.pendin != t.pendin || st.level != t.level ||
+		st.noSemi != t.noSemi || st.unfinished != t.unfinished ||
+		len(st.stack) != len(t.stack) {
+		return false
+	}
+	for i, cl := range st.stack {
+		if cl != t.stack[i] || st.white[i] != t.white[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshot records the state at the beginning of the current line, unless
+// it was already recorded. When resuming, it also checks whether the state
+// converged with the one of the previous scan.
+//
+func (s *Scanner) snapshot() {
+	if n := len(s.states); n > 0 && s.states[n-1].Offset >= s.offset {
+		return
+	}
+	st := State{
+		Offset:     s.offset,
+		stack:      append([]int(nil), s.indent.stack[:s.indent.idx+1]...),
+		white:      append([]int(nil), s.indent.white[:s.indent.idx+1]...),
+		pendin:     s.indent.pendin,
+		level:      s.indent.level,
+		noSemi:     s.noSemi,
+		unfinished: s.unfinished,
+	}
+	s.states = append(s.states, st)
+
+	if s.old == nil || s.offset < s.limit {
+		return
+	}
+	// the source from here on is unchanged, look for the same line
+	offs := s.offset - s.delta
+	i := sort.Search(len(s.old), func(i int) bool { return s.old[i].Offset >= offs })
+	if i == len(s.old) || s.old[i].Offset != offs || !s.old[i].Equal(&st) {
+		return
+	}
+	// the remaining lines scan exactly as before
+	for _, t := range s.old[i+1:] {
+		t.Offset += s.delta
+		s.states = append(s.states, t)
+	}
+	s.old = nil
+	s.converged = true
+}
+
+// States returns the line snapshots recorded so far in SnapshotLines mode,
+// ordered by offset. After a resumed scan converged, the list also includes
+// the snapshots of the unchanged lines following the edit.
+//
+func (s *Scanner) States() []State {
+	return s.states
+}
+
+// Converged reports whether a scan started with Resume has reached the
+// beginning of a line, after the edited region, in the same state as the
+// previous scan. From then on, starting with the token returned by the
+// last call to Scan, the scanner returns the same tokens as the previous
+// scan did after recording the matching State, with offsets shifted by
+// the size change of the edit. Callers re-tokenizing an edited buffer
+// can stop scanning and reuse the old tokens at that point.
+//
+func (s *Scanner) Converged() bool {
+	return s.converged
+}
+
+// Resume prepares the scanner s to re-tokenize src, the result of editing
+// a source previously scanned in SnapshotLines mode, whose snapshots are
+// states. The edit replaced the old bytes in [offs, end) with the bytes of
+// src in [offs, end+delta). Scanning resumes from the beginning of the last
+// line starting at or before offs, or from the beginning of src if there
+// is none, and the scanner is put in SnapshotLines mode.
+//
+// The file, err and mode parameters are as for Init. Line information for
+// the unchanged source before the resumed line is added to file.
+//
+func (s *Scanner) Resume(file *token.File, src []byte, err ErrorHandler, mode Mode, states []State, offs, end, delta int) {
+	if file.Size() != len(src) {
+		panic(fmt.Sprintf("file size (%d) does not match src len (%d)", file.Size(), len(src)))
+	}
+
+	i := sort.Search(len(states), func(i int) bool { return states[i].Offset > offs })
+	// a snapshot at the end of the old source may follow a raw string or
+	// a block comment cut off by it: text appended there continues them
+	for i > 0 && states[i-1].Offset >= len(src)-delta {
+		i--
+	}
+	// lines holding only comments are indented after the code following
+	// them: resume before those preceding the edited line
+	for i > 1 && onlyComments(src[states[i-2].Offset:states[i-1].Offset]) {
+		i--
+	}
+	if i == 0 {
+		s.Init(file, src, err, mode|SnapshotLines)
+	} else {
+		st := &states[i-1]
+		for j, ch := range src[:st.Offset] {
+			if ch == '\n' {
+				file.AddLine(j + 1)
+			}
+		}
+
+		s.file = file
+		s.dir, _ = filepath.Split(file.Name())
+		s.src = src
+		s.err = err
+		s.mode = mode | SnapshotLines
+
+		s.ch = ' '
+		s.offset = st.Offset
+		s.rdOffset = st.Offset
+		s.lineOffset = st.Offset
+		s.noSemi = st.noSemi
+		s.unfinished = st.unfinished
+		s.indent = indent{idx: len(st.stack) - 1, pendin: st.pendin, level: st.level}
+		copy(s.indent.stack[:], st.stack)
+		copy(s.indent.white[:], st.white)
+		s.whiteWidth = 0
+		s.ErrorCount = 0
+
+		s.next()
+		s.lineOffset = st.Offset
+	}
+
+	// keep the snapshots of the untouched lines before the resumed one
+	if i > 0 {
+		i--
+	}
+	s.states = append([]State(nil), states[:i]...)
+	s.old = states
+	s.delta = delta
+	s.limit = end + delta
+	s.converged = false
+}
+
+// InitRegion prepares s, which must have been initialized with Init, to
+// tokenize only the region [offs, end) of its source, as if the region
+// were enclosed in parentheses: line breaks do not produce semicolons
+// and indentation is not tracked. Comments are skipped. Token positions
+// remain relative to the whole file. The parser uses it to scan the
+// expressions interpolated in string literals.
+//
+func (s *Scanner) InitRegion(offs, end int) {
+	s.src = s.src[:end]
+	s.mode &^= ScanComments | SnapshotLines
+
+	s.ch = ' '
+	s.offset = offs
+	s.rdOffset = offs
+	s.lineOffset = bytes.LastIndex(s.src[:offs], []byte{'\n'}) + 1
+	s.noSemi = false
+	s.unfinished = false
+	s.indent = indent{level: 1}
+	s.whiteWidth = 0
+	s.states = nil
+	s.old = nil
+	s.converged = false
+
+	s.next()
+}
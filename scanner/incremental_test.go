@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/DAddYE/igo/token"
+)
+
+// A scanned holds a token found by a scan and its offset.
+type scanned struct {
+	offs int
+	tok  token.Token
+	lit  string
+}
+
+// fragments are the pieces edits insert, and random sources are made of.
+var fragments = []string{
+	"\n", "\n\t", "\n\t\t", "\n  ", "\n    ", "\t", " ",
+	"if x", "for i := range xs", "func f()", "return", "x = y",
+	"f(", ")", "[", "]", "a, b", "# comment", "#[ block\n ]#",
+	`"str"`, "`raw\nstring`", "0x1F", "'c'", "do:", ":", ",",
+}
+
+// randomSource returns a source made of n random fragments.
+func randomSource(r *rand.Rand, n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteString(fragments[r.Intn(len(fragments))])
+	}
+	return b.String()
+}
+
+// scanAll scans src in SnapshotLines mode, returning its tokens, its
+// line snapshots and the index of the token returned by the Scan call
+// recording each of them, by offset.
+func scanAll(src string) ([]scanned, []State, map[int]int) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	var s Scanner
+	s.Init(file, []byte(src), nil, ScanComments|SnapshotLines)
+	var toks []scanned
+	first := make(map[int]int)
+	for {
+		n := len(s.States())
+		pos, tok, lit := s.Scan()
+		for _, st := range s.States()[n:] {
+			first[st.Offset] = len(toks)
+		}
+		toks = append(toks, scanned{int(pos) - file.Base(), tok, lit})
+		if tok == token.EOF {
+			return toks, s.States(), first
+		}
+	}
+}
+
+// TestResume checks that scanning an edited source resumed from the
+// snapshots of the previous scan, and stopped once it converged, finds
+// the tokens of a full scan.
+func TestResume(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	src := randomSource(r, 40)
+	for i := 0; i < 2000; i++ {
+		old, states, first := scanAll(src)
+
+		offs := r.Intn(len(src) + 1)
+		end := offs + r.Intn(len(src)-offs+1)
+		if end-offs > 10 {
+			end = offs + 10
+		}
+		edit := randomSource(r, r.Intn(3))
+		next := src[:offs] + edit + src[end:]
+		delta := len(edit) - (end - offs)
+		if len(next) > 400 {
+			next = randomSource(r, 40)
+			src = next
+			continue
+		}
+
+		fset := token.NewFileSet()
+		file := fset.AddFile("", fset.Base(), len(next))
+		var s Scanner
+		s.Resume(file, []byte(next), nil, ScanComments, states, offs, end, delta)
+		var got []scanned
+		resumed := -1 // offset of the line scanning resumed from
+		for {
+			n := len(s.States())
+			pos, tok, lit := s.Scan()
+			if resumed < 0 {
+				resumed = s.States()[n].Offset
+			}
+			if s.Converged() {
+				// the rest is the old scan from the matching line on,
+				// the last one starting before the token or right after
+				// it, for the indents positioned at the line break
+				var st State
+				for _, x := range s.States()[n:] {
+					if x.Offset <= int(pos)-file.Base()+1 {
+						st = x
+					}
+				}
+				for _, x := range old[first[st.Offset-delta]:] {
+					got = append(got, scanned{x.offs + delta, x.tok, x.lit})
+				}
+				break
+			}
+			got = append(got, scanned{int(pos) - file.Base(), tok, lit})
+			if tok == token.EOF {
+				break
+			}
+		}
+
+		want, _, wantFirst := scanAll(next)
+		want = want[wantFirst[resumed]:]
+		if len(got) != len(want) {
+			t.Fatalf("edit %d: got %d tokens, want %d\nold: %q\nnew: %q", i, len(got), len(want), src, next)
+		}
+		for j := range got {
+			if got[j] != want[j] {
+				t.Fatalf("edit %d: token %d: got %v, want %v\nold: %q\nnew: %q", i, j, got[j], want[j], src, next)
+			}
+		}
+		src = next
+	}
+}
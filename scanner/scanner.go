@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
@@ -50,6 +51,13 @@ type Scanner struct {
 	indent     indent // stacks of indentation levels
 	whiteWidth int    // number of consecutive white spaces at beginning of line
 
+	// incremental state
+	states    []State // line snapshots (SnapshotLines mode)
+	old       []State // line snapshots of the previous scan (Resume)
+	delta     int     // size change of the edited region (Resume)
+	limit     int     // end of the edited region (Resume)
+	converged bool    // state matched the previous scan again (Resume)
+
 	// public state - ok to modify
 	ErrorCount int // number of errors encountered
 }
@@ -63,6 +71,8 @@ type indent struct {
 	pendin int            // track of indent/dedent
 	stack  [MaxIndent]int // indent stack
 	level  int            // () [] {} Parentheses nesting level, used to allow free continuations inside them
+
+	white [MaxIndent]int // bytes of white space indenting the lines opening each level, for errors
 }
 
 const bom = 0xFEFF // byte order mark, only permitted as very first character
@@ -109,7 +119,8 @@ func (s *Scanner) next() {
 type Mode uint
 
 const (
-	ScanComments Mode = 1 << iota // return comments as COMMENT tokens
+	ScanComments  Mode = 1 << iota // return comments as COMMENT tokens
+	SnapshotLines                  // record the scanner state at the beginning of each line
 )
 
 // Init prepares the scanner s to tokenize the text src by setting the
@@ -142,6 +153,13 @@ func (s *Scanner) Init(file *token.File, src []byte, err ErrorHandler, mode Mode
 	s.offset = 0
 	s.rdOffset = 0
 	s.lineOffset = 0
+	s.noSemi = false
+	s.unfinished = false
+	s.indent = indent{}
+	s.whiteWidth = 0
+	s.states = nil
+	s.old = nil
+	s.converged = false
 	s.ErrorCount = 0
 
 	s.next()
@@ -207,6 +225,50 @@ func (s *Scanner) scanComment() string {
 	return string(lit)
 }
 
+func (s *Scanner) scanBlockComment() string {
+	// initial '#' already consumed, s.ch == '['
+	offs := s.offset - 1 // position of '#'
+	hasCR := false
+
+	s.next()
+	for s.ch >= 0 {
+		ch := s.ch
+		if ch == '\r' {
+			hasCR = true
+		}
+		s.next()
+		if ch == ']' && s.ch == '#' {
+			s.next()
+			goto exit
+		}
+	}
+
+	s.error(offs, "comment not terminated")
+
+exit:
+	lit := s.src[offs:s.offset]
+	if hasCR {
+		lit = stripCR(lit)
+	}
+
+	return string(lit)
+}
+
+// endsLine reports whether only white space or a line comment follows
+// the current position up to the end of the line.
+func (s *Scanner) endsLine() bool {
+	for i, ch := range s.src[s.offset:] {
+		switch ch {
+		case ' ', '\t', '\r':
+			continue
+		case '\n':
+			return true
+		}
+		return ch == '#' && !bytes.HasPrefix(s.src[s.offset+i:], []byte("#["))
+	}
+	return true
+}
+
 func isLetter(ch rune) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch >= 0x80 && unicode.IsLetter(ch)
 }
@@ -322,6 +384,15 @@ func (s *Scanner) scanEscape(quote rune) {
 	case 'a', 'b', 'f', 'n', 'r', 't', 'v', '\\', quote:
 		s.next()
 		return
+	case '#':
+		if quote == '"' {
+			// escaped interpolation, e.g. "\#{not interpolated}"
+			s.next()
+			return
+		}
+		s.next() // always make progress
+		s.error(offs, "unknown escape sequence")
+		return
 	case '0', '1', '2', '3', '4', '5', '6', '7':
 		i, base, max = 3, 8, 255
 	case 'x':
@@ -400,6 +471,10 @@ func (s *Scanner) scanString() string {
 		if ch == '\\' {
 			s.scanEscape('"')
 		}
+		if ch == '#' && s.ch == '{' {
+			s.next()
+			s.skipInterpolation()
+		}
 	}
 
 	s.next()
@@ -407,6 +482,51 @@ func (s *Scanner) scanString() string {
 	return string(s.src[offs:s.offset])
 }
 
+// skipInterpolation skips the expression of a #{...} interpolation in
+// a string literal, up to and including the closing '}'. The parser
+// scans the expression again with InitRegion.
+//
+func (s *Scanner) skipInterpolation() {
+	// "#{" already consumed
+	depth := 0
+	for s.ch != '\n' && s.ch >= 0 {
+		ch := s.ch
+		s.next()
+		switch ch {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return
+			}
+			depth--
+		case '"', '\'', '`':
+			s.skipQuoted(ch)
+		}
+	}
+}
+
+// skipQuoted skips a string or character literal nested in an
+// interpolation; errors are reported when the parser scans it again.
+//
+func (s *Scanner) skipQuoted(quote rune) {
+	// opening quote already consumed
+	for s.ch != quote && s.ch != '\n' && s.ch >= 0 {
+		ch := s.ch
+		s.next()
+		switch {
+		case ch == '\\' && quote != '`' && s.ch != '\n':
+			s.next()
+		case ch == '#' && s.ch == '{' && quote == '"':
+			s.next()
+			s.skipInterpolation()
+		}
+	}
+	if s.ch == quote {
+		s.next()
+	}
+}
+
 func stripCR(b []byte) []byte {
 	c := make([]byte, len(b))
 	i := 0
@@ -489,9 +609,244 @@ exit:
 	if hasCR {
 		lit = stripCR(lit)
 	}
+	if terminated && len(lit) >= 6 {
+		if _, bad := dedent(string(lit)); bad >= 0 {
+			s.error(offs+bad, "line indented less than the closing \"\"\"")
+		}
+	}
 	return string(lit)
 }
 
+// scanVerbatim scans a go! region, whose "go" was already consumed: the
+// rest of its line, which must be blank, and the lines following it which
+// are indented deeper, up to the last one which is not blank. These must
+// all start with the indentation of the first one.
+//
+func (s *Scanner) scanVerbatim() string {
+	offs := s.offset - 2
+	s.next() // '!'
+	for s.ch == ' ' || s.ch == '\t' || s.ch == '\r' {
+		s.next()
+	}
+	if s.ch != '\n' && s.ch >= 0 {
+		s.error(s.offset, "expected newline after go!")
+		for s.ch != '\n' && s.ch >= 0 {
+			s.next()
+		}
+	}
+
+	level := s.indent.stack[s.indent.idx]
+	end := s.offset // end of the last line of the region
+	var indent []byte
+	var bad []int // offsets of the lines not starting with indent
+	for eol := end; eol < len(s.src); {
+		bol := eol + 1
+		cl, i := 0, bol
+		for ; i < len(s.src) && (s.src[i] == ' ' || s.src[i] == '\t'); i++ {
+			if s.src[i] == '\t' {
+				cl += 2
+			} else {
+				cl++
+			}
+		}
+		if eol = bytes.IndexByte(s.src[bol:], '\n'); eol < 0 {
+			eol = len(s.src)
+		} else {
+			eol += bol
+		}
+		if len(bytes.TrimSpace(s.src[i:eol])) == 0 {
+			continue
+		}
+		if cl <= level {
+			break
+		}
+		if indent == nil {
+			indent = s.src[bol:i]
+		} else if !bytes.HasPrefix(s.src[bol:], indent) {
+			bad = append(bad, bol)
+		}
+		end = eol
+	}
+	if indent == nil {
+		s.error(offs, "expected indented Go source after go!")
+	}
+
+	for s.offset < end {
+		s.next()
+	}
+	// report after the lines were added to the file
+	for _, offs := range bad {
+		s.error(offs, "inconsistent indentation in go! region")
+	}
+	return string(s.src[offs:end])
+}
+
+// dedent returns the value of the triple-quoted string literal lit. If
+// the opening """ is followed by a line break and the closing one starts
+// its line after white space only, the value is made of the lines in
+// between, stripped of the indentation of the closing """; otherwise it
+// is the text between the delimiters. bad is the offset in lit of the
+// first non-blank line not starting with that indentation, or -1.
+//
+func dedent(lit string) (value string, bad int) {
+	body := lit[3 : len(lit)-3]
+	i := strings.LastIndex(body, "\n")
+	if !strings.HasPrefix(body, "\n") || strings.Trim(body[i+1:], " \t") != "" {
+		return body, -1
+	}
+	if i == 0 {
+		return "", -1
+	}
+	indent := body[i+1:]
+	lines := strings.Split(body[1:i], "\n")
+	bad = -1
+	offs := 4 // start of the first line in lit
+	for j, line := range lines {
+		switch {
+		case strings.HasPrefix(line, indent):
+			lines[j] = line[len(indent):]
+		case strings.Trim(line, " \t") == "":
+			lines[j] = ""
+		default:
+			if bad < 0 {
+				bad = offs
+			}
+			lines[j] = strings.TrimLeft(line, " \t")
+		}
+		offs += len(line) + 1
+	}
+	return strings.Join(lines, "\n"), bad
+}
+
+// TripleQuoted returns the value of the triple-quoted string literal lit,
+// dedented relative to the closing delimiter as described for dedent.
+//
+func TripleQuoted(lit string) string {
+	value, _ := dedent(lit)
+	return value
+}
+
+// popIndent pops the indentation levels deeper than cl, the level of the
+// current line. If cl is not one of the enclosing levels, it reports an
+// error listing their columns and recovers as if the line was indented
+// at the closest one, the deeper on ties, so that a single misindented
+// line produces a single error.
+//
+func (s *Scanner) popIndent(cl int) {
+	i := s.indent.idx
+	for i > 0 && cl < s.indent.stack[i] {
+		i--
+	}
+	if cl != s.indent.stack[i] {
+		// stack[i] < cl < stack[i+1]
+		var cols []byte
+		for j := 0; j <= s.indent.idx; j++ {
+			switch {
+			case j == s.indent.idx:
+				cols = append(cols, " or "...)
+			case j > 0:
+				cols = append(cols, ", "...)
+			}
+			cols = strconv.AppendInt(cols, int64(s.indent.white[j]+1), 10)
+		}
+		s.error(s.offset, "inconsistent indentation, expected column "+string(cols))
+		if s.indent.stack[i+1]-cl <= cl-s.indent.stack[i] {
+			i++
+		}
+	}
+	s.indent.pendin -= s.indent.idx - i
+	s.indent.idx = i
+}
+
+// commentIndent returns the indentation level to use for a line holding
+// only comments, indented by cl and followed by code indented by next.
+// The comments open a block only if the code following does, and close
+// only the blocks it closes as well; within those bounds they stay at the
+// enclosing level they are indented in.
+//
+func (s *Scanner) commentIndent(cl, next int) int {
+	cur := s.indent.stack[s.indent.idx]
+	switch {
+	case cl > cur && next > cur:
+		return next
+	case cl < cur:
+		i := s.indent.idx
+		for s.indent.stack[i] > cl && s.indent.stack[i] > next {
+			i--
+		}
+		return s.indent.stack[i]
+	}
+	return cur
+}
+
+// commentEnd returns the offset of the end of the line starting at offs,
+// after any indentation, if the line holds only comments; otherwise -1.
+func commentEnd(src []byte, offs int) int {
+	for offs < len(src) && src[offs] == '#' {
+		if offs+1 < len(src) && src[offs+1] == '[' {
+			i := bytes.Index(src[offs+2:], []byte("]#"))
+			if i < 0 {
+				return len(src)
+			}
+			offs += i + 4
+			for offs < len(src) && (src[offs] == ' ' || src[offs] == '\t' || src[offs] == '\r') {
+				offs++
+			}
+			continue
+		}
+		if i := bytes.IndexByte(src[offs:], '\n'); i >= 0 {
+			return offs + i
+		}
+		return len(src)
+	}
+	if offs == len(src) || src[offs] == '\n' {
+		return offs
+	}
+	return -1
+}
+
+// codeIndent returns the indentation width and the bytes of white space
+// indenting the first line following the one ending at offs which holds
+// more than comments and white space; or 0, 0 if there is none.
+func codeIndent(src []byte, offs int) (cl, white int) {
+	for offs < len(src) {
+		offs++ // skip '\n'
+		bol := offs
+		cl = 0
+		for ; offs < len(src); offs++ {
+			if src[offs] == '\t' {
+				cl += 2
+			} else if src[offs] == ' ' {
+				cl++
+			} else {
+				break
+			}
+		}
+		white = offs - bol
+		if offs < len(src) && src[offs] == '\r' {
+			offs++
+		}
+		if offs = commentEnd(src, offs); offs < 0 {
+			return cl, white
+		}
+	}
+	return 0, 0
+}
+
+// onlyComments reports whether the lines in src hold only comments and
+// white space.
+func onlyComments(src []byte) bool {
+	for offs := 0; offs < len(src); offs++ {
+		for offs < len(src) && (src[offs] == ' ' || src[offs] == '\t' || src[offs] == '\r') {
+			offs++
+		}
+		if offs = commentEnd(src, offs); offs < 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // This allows '\n' since is needed for indenting tracks
 func (s *Scanner) cleanCRLF() {
 	for s.ch == '\n' || s.ch == '\r' {
@@ -590,6 +945,9 @@ newLine:
 	pos = s.file.Pos(s.offset)
 
 	if s.offset == s.lineOffset {
+		if s.mode&SnapshotLines != 0 {
+			s.snapshot()
+		}
 
 		cl := 0 // current level
 
@@ -606,6 +964,17 @@ newLine:
 		}
 
 		blankLine = s.ch == '\n'
+		white := s.whiteWidth
+
+		// A line holding only comments doesn't open or close blocks
+		// on its own, it follows the indentation of the code around it
+		if s.ch == '#' && s.indent.level == 0 && !s.unfinished {
+			if end := commentEnd(s.src, s.offset); end >= 0 {
+				var next int
+				next, white = codeIndent(s.src, end)
+				cl = s.commentIndent(cl, next)
+			}
+		}
 
 		// If we are not inside [](){}
 		// Comments '#' or empty lines, should not affect indentation
@@ -617,14 +986,9 @@ newLine:
 				s.indent.idx++
 				s.indent.pendin++
 				s.indent.stack[s.indent.idx] = cl
+				s.indent.white[s.indent.idx] = white
 			default:
-				for s.indent.idx > 0 && cl < s.indent.stack[s.indent.idx] {
-					s.indent.pendin--
-					s.indent.idx--
-				}
-				if cl != s.indent.stack[s.indent.idx] {
-					s.error(s.offset, "incosistent indentation")
-				}
+				s.popIndent(cl)
 			}
 		}
 	}
@@ -639,13 +1003,13 @@ newLine:
 		return pos - 1, token.INDENT, "{"
 	}
 
-	// current token start
-	pos = s.file.Pos(s.offset)
-
 scanAgain:
 
 	s.skipWhitespace()
 
+	// current token start
+	pos = s.file.Pos(s.offset)
+
 	// determine token value
 	switch ch := s.ch; {
 	case isLetter(ch):
@@ -657,6 +1021,11 @@ scanAgain:
 			case token.CASE, token.DEFAULT:
 				s.unfinished = true
 				return
+			case token.GO:
+				if s.ch == '!' {
+					tok = token.VERBATIM
+					lit = s.scanVerbatim()
+				}
 			}
 		} else {
 			tok = token.IDENT
@@ -754,8 +1123,23 @@ scanAgain:
 			s.unfinished = true
 			return
 		case '#':
+			if s.ch == '[' {
+				// block comment, it can sit anywhere in a line and
+				// does not affect the status of the line
+				bol := s.file.Offset(pos)-s.whiteWidth == s.lineOffset
+				lit = s.scanBlockComment()
+				if bol && s.indent.level == 0 && s.endsLine() {
+					s.noSemi = true
+				}
+				if s.mode&ScanComments == 0 {
+					goto scanAgain
+				}
+				tok = token.COMMENT
+				return
+			}
 			// comment
-			s.noSemi = s.file.Offset(pos)-s.whiteWidth == s.lineOffset // start a beginning of line
+			// a comment starting a line outside of () [] {} is not a statement
+			s.noSemi = s.indent.level == 0 && s.file.Offset(pos)-s.whiteWidth == s.lineOffset
 			lit = s.scanComment()
 			if s.mode&ScanComments == 0 {
 				// skip comment
@@ -812,6 +1196,21 @@ scanAgain:
 			tok = s.switch3(token.OR, token.OR_ASSIGN, '|', token.LOR)
 			s.unfinished = true
 			return
+		case '~':
+			tok = token.TILDE
+			s.unfinished = true
+			return
+		case '@':
+			// escaped identifier, such as @do for a Go name which
+			// is an iGo keyword; the literal keeps the '@'
+			if !isLetter(s.ch) {
+				s.error(s.file.Offset(pos), "expected identifier after @")
+				tok = token.ILLEGAL
+				lit = "@"
+				break
+			}
+			tok = token.IDENT
+			lit = "@" + s.scanIdentifier()
 		default:
 			// next reports unexpected BOMs - don't repeat
 			if ch != bom {
@@ -824,3 +1223,15 @@ scanAgain:
 	s.unfinished = false
 	return
 }
+
+// Peek returns the token the next call to Scan would return, leaving the
+// scanner unchanged. Errors found while peeking are not reported; they are
+// when the token is scanned.
+//
+func (s *Scanner) Peek() token.Token {
+	t := *s
+	t.err = nil
+	t.mode &^= SnapshotLines
+	_, tok, _ := t.Scan()
+	return tok
+}
@@ -0,0 +1,43 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/DAddYE/igo/token"
+)
+
+// scanErrors holds sources and the first error scanning them reports.
+var scanErrors = []struct {
+	name string
+	src  string
+	err  string
+}{
+	{"dedent between tabs", "if x\n\t\ty\n\tz\n", "3:2: inconsistent indentation, expected column 1 or 3"},
+	{"dedent between spaces", "if x\n    if y\n        z\n      w\n", "4:7: inconsistent indentation, expected column 1, 5 or 9"},
+	{"dedent after a comment", "if x\n\t# c\n\t\ty\n z\n", "4:2: inconsistent indentation, expected column 1 or 3"},
+}
+
+func TestScanErrors(t *testing.T) {
+	for _, tt := range scanErrors {
+		t.Run(tt.name, func(t *testing.T) {
+			fset := token.NewFileSet()
+			file := fset.AddFile("", fset.Base(), len(tt.src))
+			var got string
+			eh := func(pos token.Position, msg string) {
+				if got == "" {
+					got = pos.String() + ": " + msg
+				}
+			}
+			var s Scanner
+			s.Init(file, []byte(tt.src), eh, ScanComments)
+			for {
+				if _, tok, _ := s.Scan(); tok == token.EOF {
+					break
+				}
+			}
+			if got != tt.err {
+				t.Errorf("got %q, want %q", got, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,2946 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements printing of iGo-only constructs,
+// which have no direct Go counterpart and are lowered
+// to equivalent Go code.
+
+package to_go
+
+import (
+	"fmt"
+	"go/build"
+	"go/constant"
+	gotoken "go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/DAddYE/igo/ast"
+	"github.com/DAddYE/igo/token"
+)
+
+// ----------------------------------------------------------------------------
+// Imports
+
+// autoImports records the names under which src imports its packages and
+// the packages needed by the lowered constructs of src, or referred to by
+// the macros it invokes, but not imported by src itself. These are merged
+// into the first import declaration of src by importGroup, or else printed
+// in a declaration of their own after the package clause.
+//
+func (p *printer) autoImports(src *ast.File) {
+	p.imports = make(map[string]string)
+	for _, s := range src.Imports {
+		ipath, err := strconv.Unquote(s.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(ipath)
+		if s.Name != nil {
+			name = s.Name.Name
+		}
+		switch name {
+		case "_":
+			continue
+		case ".":
+			name = ""
+		}
+		p.imports[ipath] = name
+	}
+
+	var missing []string
+	need := func(ipath, name string) {
+		if _, found := p.imports[ipath]; !found {
+			p.imports[ipath] = name
+			missing = append(missing, ipath)
+		}
+	}
+	used := make(map[string]bool)     // names of the packages referred to
+	selected := make(map[string]bool) // names of the packages of exported selectors
+	expanded := make(map[*macroDef]bool)
+	formats := make(map[*ast.InterpolatedLit]bool) // formats of printfFuncs calls
+	var inspect func(n ast.Node) bool
+	inspect = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.MacroDecl:
+			// inspected where invoked
+			return false
+		case *ast.SelectorExpr:
+			if x, isIdent := n.X.(*ast.Ident); isIdent && x.Obj == nil {
+				used[x.Name] = true
+				if ast.IsExported(n.Sel.Name) && p.lookup(x) == nil {
+					selected[x.Name] = true
+				}
+			}
+		case *ast.CallExpr:
+			if lit, _ := p.formatLit(n); lit != nil {
+				formats[lit] = true
+			}
+		case *ast.MacroExpr:
+			if m := p.macros[n.Name.Name]; m != nil && !expanded[m] {
+				expanded[m] = true
+				ast.Inspect(m.decl.Body, func(n ast.Node) bool {
+					// the packages referred to by the macro
+					if x, isSel := n.(*ast.SelectorExpr); isSel {
+						if id, isIdent := x.X.(*ast.Ident); isIdent && id.Obj == nil {
+							if ipath, found := m.imports[id.Name]; found {
+								need(ipath, id.Name)
+							}
+						}
+					}
+					return inspect(n)
+				})
+			}
+		}
+		if x, isLit := n.(*ast.InterpolatedLit); isLit && formats[x] {
+			return true // lowered to the arguments of its call
+		}
+		for _, ipath := range neededImports(n) {
+			need(ipath, path.Base(ipath))
+		}
+		return true
+	}
+	ast.Inspect(src, inspect)
+	p.blankImports = macroImports(src, used)
+	embedImports(src, used, p.blankImports)
+
+	if p.Mode&ImportStd != 0 {
+		// only the undeclared names selecting an exported name
+		// are taken for the names of standard library packages
+		imported := make(map[string]bool)
+		for _, name := range p.imports {
+			imported[name] = true
+		}
+		var names []string
+		for name := range selected {
+			if !imported[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if ipath := stdPackage(name); ipath != "" {
+				need(ipath, name)
+			}
+		}
+	}
+
+	if len(missing) == 0 {
+		return
+	}
+	sort.Strings(missing)
+	p.missing = missing
+	if len(src.Decls) > 0 {
+		if d, isGen := src.Decls[0].(*ast.GenDecl); isGen && d.Tok == token.IMPORT && !hasPreamble(d) {
+			p.importDecl = d
+			return
+		}
+	}
+	// the declaration is printed at the end of the package clause,
+	// before the comments following it
+	at := src.Name.End()
+	p.print(newline, newline, at, token.IMPORT, blank)
+	if len(missing) > 1 {
+		p.print(at, token.LPAREN, indent)
+	}
+	for _, ipath := range missing {
+		if len(missing) > 1 {
+			p.print(newline)
+		}
+		p.print(at)
+		p.missingImport(ipath)
+	}
+	if len(missing) > 1 {
+		p.print(unindent, newline, at, token.RPAREN)
+	}
+}
+
+// missingImport prints the import spec of the missing package ipath.
+func (p *printer) missingImport(ipath string) {
+	if name := p.imports[ipath]; name != path.Base(ipath) {
+		p.print(ast.NewIdent(name), blank)
+	}
+	p.print(&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(ipath)})
+}
+
+// importGroup prints the import declaration d, the first one of the file,
+// as a group holding the missing imports too. They are merged, in order,
+// into its first section of specs not separated by blank lines.
+//
+func (p *printer) importGroup(d *ast.GenDecl) {
+	p.setComment(d.Doc)
+	p.print(d.Pos(), d.Tok, blank)
+	if d.Indent.IsValid() {
+		p.print(d.Indent)
+	}
+	p.print(token.LPAREN, indent, formfeed)
+	missing := p.missing
+	printed := false // whether a spec was printed
+	flush := func(before string) {
+		for len(missing) > 0 && (before == "" || missing[0] < before) {
+			if printed {
+				p.print(newline)
+			}
+			p.missingImport(missing[0])
+			missing, printed = missing[1:], true
+		}
+	}
+	firstSection := true
+	for i, s := range d.Specs {
+		s := s.(*ast.ImportSpec)
+		min := 1
+		if i > 0 && p.lineFor(s.Pos())-p.lineFor(d.Specs[i-1].End()) > 1 {
+			if firstSection {
+				flush("")
+				firstSection = false
+			}
+			min = 2
+		}
+		if firstSection {
+			ipath, _ := strconv.Unquote(s.Path.Value)
+			flush(ipath)
+		}
+		if printed {
+			p.linebreak(p.lineFor(s.Pos()), min, ignore, false)
+		}
+		p.spec(s, len(d.Specs), false)
+		printed = true
+	}
+	flush("")
+	p.print(unindent, formfeed)
+	if d.Dedent.IsValid() {
+		p.print(d.Dedent)
+	}
+	p.print(token.RPAREN)
+}
+
+// stdPackages maps the names of the standard library packages to
+// their import paths; it is set up by the first call of stdPackage.
+//
+var stdPackages map[string]string
+
+// preferredStd resolves the names shared by standard library packages.
+var preferredStd = map[string]string{
+	"rand":     "math/rand",
+	"scanner":  "text/scanner",
+	"template": "text/template",
+}
+
+// stdPackage returns the import path of the standard library package
+// named name, or "". Among packages of the same name, the one with the
+// shortest import path is chosen.
+//
+func stdPackage(name string) string {
+	if ipath, found := preferredStd[name]; found {
+		return ipath
+	}
+	if stdPackages == nil {
+		stdPackages = make(map[string]string)
+		root := filepath.Join(build.Default.GOROOT, "src")
+		filepath.Walk(root, func(dir string, f os.FileInfo, err error) error {
+			if err != nil || !f.IsDir() || dir == root {
+				return nil
+			}
+			switch f.Name() {
+			case "cmd", "internal", "testdata", "vendor":
+				return filepath.SkipDir
+			}
+			if files, _ := filepath.Glob(filepath.Join(dir, "*.go")); len(files) == 0 {
+				return nil
+			}
+			ipath := filepath.ToSlash(dir[len(root)+1:])
+			if old, found := stdPackages[f.Name()]; !found || len(ipath) < len(old) {
+				stdPackages[f.Name()] = ipath
+			}
+			return nil
+		})
+	}
+	return stdPackages[name]
+}
+
+// neededImports returns the import paths of the packages referred
+// to by the lowered form of n.
+//
+func neededImports(n ast.Node) []string {
+	switch n := n.(type) {
+	case *ast.EnumDecl:
+		return []string{"fmt"}
+	case *ast.InterpolatedLit:
+		if len(n.Exprs) == 0 {
+			return nil
+		}
+		if !canConcat(n) {
+			return []string{"fmt"}
+		}
+		for _, e := range n.Exprs {
+			if e.Verb != "%s" {
+				return []string{"strconv"}
+			}
+		}
+	}
+	return nil
+}
+
+// qualifiedName returns a reference to the exported name of the package
+// with the given import path, positioned at pos.
+//
+func (p *printer) qualifiedName(ipath, name string, pos token.Pos) ast.Expr {
+	pkg, found := p.imports[ipath]
+	if !found {
+		pkg = path.Base(ipath)
+	}
+	sel := &ast.Ident{NamePos: pos, Name: name}
+	if pkg == "" {
+		return sel
+	}
+	return &ast.SelectorExpr{X: &ast.Ident{NamePos: pos, Name: pkg}, Sel: sel}
+}
+
+// qualified prints a reference to the exported name of the package
+// with the given import path.
+//
+func (p *printer) qualified(ipath, name string) {
+	pkg, found := p.imports[ipath]
+	if !found {
+		pkg = path.Base(ipath)
+	}
+	if pkg != "" {
+		p.print(ast.NewIdent(pkg), token.PERIOD)
+	}
+	p.print(ast.NewIdent(name))
+}
+
+// ----------------------------------------------------------------------------
+// Interpolated strings
+
+// concatVerbs maps the verbs for which an interpolation can be lowered
+// to a string concatenation to the strconv function used, if any.
+var concatVerbs = map[string]string{
+	"%s": "",
+	"%d": "FormatInt",
+	"%t": "FormatBool",
+	"%q": "Quote",
+}
+
+// canConcat reports whether every expression interpolated in x has one
+// of the verbs in concatVerbs and an operand known, without type checking,
+// to suit its strconv function: a string for %s and %q, an untyped integer
+// or rune constant for %d, and true or false for %t. Any other operand,
+// such as an error or a Stringer for %s, a rune for %q or an unsigned
+// integer for %d, is only formatted right by fmt.Sprintf.
+//
+func canConcat(x *ast.InterpolatedLit) bool {
+	for _, e := range x.Exprs {
+		var ok bool
+		switch e.Verb {
+		case "%s", "%q":
+			ok = isString(e.X)
+		case "%d":
+			ok = isIntConst(e.X)
+		case "%t":
+			ok = isBoolConst(e.X)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// isString reports whether x is known to be a string: a string literal,
+// a conversion to string, or a sum with such an operand.
+//
+func isString(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		return x.Kind == token.STRING
+	case *ast.InterpolatedLit:
+		return true
+	case *ast.ParenExpr:
+		return isString(x.X)
+	case *ast.BinaryExpr:
+		return x.Op == token.ADD && (isString(x.X) || isString(x.Y))
+	case *ast.CallExpr:
+		id, isIdent := x.Fun.(*ast.Ident)
+		return isIdent && id.Name == "string" && id.Obj == nil && len(x.Args) == 1
+	}
+	return false
+}
+
+// isIntConst reports whether x is an untyped integer or rune constant
+// made of literals.
+//
+func isIntConst(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		return x.Kind == token.INT || x.Kind == token.CHAR
+	case *ast.ParenExpr:
+		return isIntConst(x.X)
+	case *ast.UnaryExpr:
+		return (x.Op == token.SUB || x.Op == token.ADD) && isIntConst(x.X)
+	}
+	return false
+}
+
+// isBoolConst reports whether x is the predeclared true or false.
+func isBoolConst(x ast.Expr) bool {
+	id, isIdent := x.(*ast.Ident)
+	return isIdent && (id.Name == "true" || id.Name == "false") && id.Obj == nil
+}
+
+// unescapeHash removes the backslash from the \# escapes of the
+// interpreted string literal text s, which are not valid in Go.
+//
+func unescapeHash(s string) string {
+	if !strings.Contains(s, `\#`) {
+		return s
+	}
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] != '#' {
+				buf = append(buf, '\\')
+			}
+		}
+		buf = append(buf, s[i])
+	}
+	return string(buf)
+}
+
+// interpolationTexts returns the texts surrounding the expressions
+// interpolated in x, as the contents of Go interpreted string literals.
+// The first text starts at offset offs[0] of x.Value, and so on.
+//
+func interpolationTexts(x *ast.InterpolatedLit) (texts []string, offs []int) {
+	start := 1 // skip opening quote
+	for _, e := range x.Exprs {
+		texts = append(texts, unescapeHash(x.Value[start:int(e.Lbrace-x.ValuePos)]))
+		offs = append(offs, start)
+		start = int(e.Rbrace-x.ValuePos) + 1
+	}
+	texts = append(texts, unescapeHash(x.Value[start:len(x.Value)-1]))
+	offs = append(offs, start)
+	return
+}
+
+// interpolatedLit prints the string literal x lowering its interpolations:
+// to a concatenation if canConcat(x) holds, with strconv conversions for
+// the non-%s verbs, and to a fmt.Sprintf call otherwise.
+//
+func (p *printer) interpolatedLit(x *ast.InterpolatedLit, prec1, depth int) {
+	texts, offs := interpolationTexts(x)
+	text := func(i int) *ast.BasicLit {
+		return &ast.BasicLit{ValuePos: x.ValuePos + token.Pos(offs[i]), Kind: token.STRING, Value: `"` + texts[i] + `"`}
+	}
+
+	if len(x.Exprs) == 0 {
+		p.print(text(0))
+		return
+	}
+
+	if !canConcat(x) {
+		var format []byte
+		for i, s := range formatTexts(texts) {
+			format = append(format, strings.Replace(s, "%", "%%", -1)...)
+			if i < len(x.Exprs) {
+				format = append(format, verbOf(x.Exprs[i])...)
+			}
+		}
+		p.print(x.ValuePos)
+		p.qualified("fmt", "Sprintf")
+		p.print(token.LPAREN, &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(string(format))})
+		for _, e := range x.Exprs {
+			p.print(token.COMMA, blank)
+			p.expr0(e.X, depth+1)
+		}
+		p.print(token.RPAREN)
+		return
+	}
+
+	// the concatenation needs parentheses if used as an operand
+	// of an operator binding tighter than +
+	n := len(x.Exprs)
+	for _, t := range texts {
+		if t != "" {
+			n++
+		}
+	}
+	paren := prec1 > token.ADD.Precedence()
+	if n == 1 {
+		_, isBinary := x.Exprs[0].X.(*ast.BinaryExpr)
+		paren = paren && isBinary && x.Exprs[0].Verb == "%s"
+	}
+	if paren {
+		p.print(token.LPAREN)
+	}
+	first := true
+	add := func() {
+		if !first {
+			p.print(blank, token.ADD, blank)
+		}
+		first = false
+	}
+	for i, t := range texts {
+		if t != "" {
+			add()
+			p.print(text(i))
+		}
+		if i == len(x.Exprs) {
+			break
+		}
+		e := x.Exprs[i]
+		add()
+		switch fun := concatVerbs[e.Verb]; fun {
+		case "":
+			p.expr1(e.X, token.ADD.Precedence(), depth)
+		case "FormatInt":
+			p.qualified("strconv", fun)
+			p.print(token.LPAREN, ast.NewIdent("int64"), token.LPAREN)
+			p.expr0(e.X, depth+1)
+			p.print(token.RPAREN, token.COMMA, blank, &ast.BasicLit{Kind: token.INT, Value: "10"}, token.RPAREN)
+		default:
+			p.qualified("strconv", fun)
+			p.print(token.LPAREN)
+			p.expr0(e.X, depth+1)
+			p.print(token.RPAREN)
+		}
+	}
+	if paren {
+		p.print(token.RPAREN)
+	}
+}
+
+// verbOf returns the format verb of the interpolation e.
+func verbOf(e *ast.Interpolation) string {
+	if e.Verb == "" {
+		return "%v"
+	}
+	return e.Verb
+}
+
+// formatTexts returns the values of the texts of interpolationTexts.
+func formatTexts(texts []string) []string {
+	values := make([]string, len(texts))
+	for i, t := range texts {
+		s, err := strconv.Unquote(`"` + t + `"`)
+		if err != nil {
+			s = t // already reported by the scanner
+		}
+		values[i] = s
+	}
+	return values
+}
+
+// printfFuncs maps the import paths of packages to their functions taking
+// a format string, and the index of the format among their arguments.
+var printfFuncs = map[string]map[string]int{
+	"fmt": {"Errorf": 0, "Fprintf": 1, "Printf": 0, "Sprintf": 0},
+	"log": {"Fatalf": 0, "Panicf": 0, "Printf": 0},
+}
+
+// formatLit returns the string literal with interpolations passed as the
+// format of the call x to one of the printfFuncs, and its index among the
+// arguments; or nil. The interpolations of the format are lowered to the
+// verbs and arguments of the call itself by formatArgs.
+//
+func (p *printer) formatLit(x *ast.CallExpr) (*ast.InterpolatedLit, int) {
+	sel, isSel := x.Fun.(*ast.SelectorExpr)
+	if !isSel || x.Ellipsis.IsValid() {
+		return nil, 0
+	}
+	pkg, isIdent := sel.X.(*ast.Ident)
+	if !isIdent || pkg.Obj != nil {
+		return nil, 0
+	}
+	for ipath, funcs := range printfFuncs {
+		name, found := p.imports[ipath]
+		if !found {
+			name = path.Base(ipath)
+		}
+		i, isPrintf := funcs[sel.Sel.Name]
+		if !isPrintf || pkg.Name != name || i >= len(x.Args) {
+			continue
+		}
+		if lit, isLit := x.Args[i].(*ast.InterpolatedLit); isLit && len(lit.Exprs) > 0 && formatArgs(lit, nil) != nil {
+			return lit, i
+		}
+	}
+	return nil, 0
+}
+
+// formatArgs returns the format x, with the verbs of its interpolations,
+// followed by the interpolated expressions and the arguments args of the
+// format, in the order of their verbs; or nil if the texts of x index
+// the arguments explicitly. The texts are part of the format, as those
+// of a plain string literal.
+//
+func formatArgs(x *ast.InterpolatedLit, args []ast.Expr) []ast.Expr {
+	texts, _ := interpolationTexts(x)
+	var format []byte
+	var list []ast.Expr
+	for i, s := range formatTexts(texts) {
+		n, ok := countVerbs(s)
+		if !ok {
+			return nil
+		}
+		if n > len(args) {
+			n = len(args)
+		}
+		list, args = append(list, args[:n]...), args[n:]
+		format = append(format, s...)
+		if i < len(x.Exprs) {
+			format = append(format, verbOf(x.Exprs[i])...)
+			list = append(list, x.Exprs[i].X)
+		}
+	}
+	lit := &ast.BasicLit{ValuePos: x.ValuePos, Kind: token.STRING, Value: strconv.Quote(string(format))}
+	return append(append([]ast.Expr{lit}, list...), args...)
+}
+
+// countVerbs returns the number of arguments consumed by the verbs of the
+// format s, and false if it indexes them explicitly, as in "%[1]d".
+//
+func countVerbs(s string) (n int, ok bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			continue
+		}
+		for i++; i < len(s) && strings.IndexByte("+-# 0123456789.*", s[i]) >= 0; i++ {
+			if s[i] == '*' {
+				n++ // width or precision argument
+			}
+		}
+		if i < len(s) && s[i] == '[' {
+			return 0, false
+		}
+		if i < len(s) && s[i] != '%' {
+			n++
+		}
+	}
+	return n, true
+}
+
+// ----------------------------------------------------------------------------
+// Triple-quoted strings
+
+// goString returns a Go string literal with value s: a raw string literal
+// if s can be written as one, an interpreted string literal otherwise.
+//
+func goString(s string) string {
+	if canBackquote(s) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+// canBackquote reports whether s can be written unchanged as a Go raw
+// string literal, possibly spanning several lines.
+//
+func canBackquote(s string) bool {
+	for len(s) > 0 {
+		r, wid := utf8.DecodeRuneInString(s)
+		s = s[wid:]
+		if wid > 1 {
+			if r == '\ufeff' {
+				return false // BOMs are invisible and should not be quoted
+			}
+			continue // all other multibyte runes are correctly encoded
+		}
+		if r == utf8.RuneError || r == '`' || r == '\r' || r == 0x7f ||
+			r < ' ' && r != '\t' && r != '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+// ----------------------------------------------------------------------------
+// Statement modifiers
+
+// postfixStmt prints s as an if statement with s.Stmt as its body. The
+// condition of an "unless" modifier is negated.
+//
+func (p *printer) postfixStmt(s *ast.PostfixStmt) {
+	cond := s.Cond
+	if s.Tok == token.UNLESS {
+		cond = negate(cond)
+	}
+	p.print(s.TokPos, token.IF, blank)
+	p.expr(cond)
+	p.print(blank, token.LBRACE, indent, newline)
+	p.stmt(s.Stmt, true)
+	p.print(unindent, newline, s.End(), token.RBRACE)
+}
+
+// negate returns the negation of the boolean expression x.
+func negate(x ast.Expr) ast.Expr {
+	switch t := x.(type) {
+	case *ast.UnaryExpr:
+		if t.Op == token.NOT {
+			return t.X
+		}
+	case *ast.BinaryExpr:
+		x = &ast.ParenExpr{Lparen: t.Pos(), X: t, Rparen: t.End()}
+	}
+	return &ast.UnaryExpr{OpPos: x.Pos(), Op: token.NOT, X: x}
+}
+
+// ----------------------------------------------------------------------------
+// Source macros
+
+// macroLit prints the literal the source macro x stands for: the base
+// name of the source file for __filename__, the name of the enclosing
+// function for __fname__, the line for __line__ and the import path of
+// the package for __pkg__.
+//
+func (p *printer) macroLit(x *ast.MacroLit) {
+	pos := p.posFor(x.NamePos)
+	lit := &ast.BasicLit{ValuePos: x.NamePos, Kind: token.STRING}
+	switch x.Name {
+	case "__filename__":
+		lit.Value = strconv.Quote(filepath.Base(pos.Filename))
+	case "__fname__":
+		lit.Value = strconv.Quote(p.fname)
+	case "__line__":
+		lit.Kind = token.INT
+		lit.Value = strconv.Itoa(pos.Line)
+	case "__pkg__":
+		if p.pkgPath == "" {
+			p.pkgPath = pkgPath(filepath.Dir(pos.Filename), p.pkgName)
+		}
+		lit.Value = strconv.Quote(p.pkgPath)
+	}
+	p.print(lit)
+}
+
+// funcName returns the name of the function declared by d, qualified
+// by its receiver type for methods: "F", "T.M" or "(*T).M".
+//
+func funcName(d *ast.FuncDecl) string {
+	if d.Recv == nil || len(d.Recv.List) == 0 {
+		return goName(d.Name)
+	}
+	typ, ptr := d.Recv.List[0].Type, false
+	if t, isStar := typ.(*ast.StarExpr); isStar {
+		typ, ptr = t.X, true
+	}
+	// ignore the type parameters of generic receivers
+	switch t := typ.(type) {
+	case *ast.IndexExpr:
+		typ = t.X
+	case *ast.IndexListExpr:
+		typ = t.X
+	}
+	recv, ok := typ.(*ast.Ident)
+	if !ok {
+		return goName(d.Name)
+	}
+	if ptr {
+		return "(*" + goName(recv) + ")." + goName(d.Name)
+	}
+	return goName(recv) + "." + goName(d.Name)
+}
+
+// goName returns the name of id in Go, without the @ escaping it.
+func goName(id *ast.Ident) string {
+	return strings.TrimPrefix(id.Name, "@")
+}
+
+// pkgPath returns the import path of the package in the directory dir:
+// its path in the module of the nearest go.mod file or, without one, in
+// the GOPATH workspace; or its name if dir is in neither.
+//
+func pkgPath(dir, name string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return name
+	}
+	for root := abs; ; {
+		if data, err := ioutil.ReadFile(filepath.Join(root, "go.mod")); err == nil {
+			mod := modulePath(data)
+			rel, err := filepath.Rel(root, abs)
+			if mod == "" || err != nil {
+				return name
+			}
+			return path.Join(mod, filepath.ToSlash(rel))
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			break
+		}
+		root = parent
+	}
+	pkg, err := build.ImportDir(abs, build.FindOnly)
+	if err == nil && !build.IsLocalImport(pkg.ImportPath) {
+		return pkg.ImportPath
+	}
+	return name
+}
+
+// modulePath returns the module path declared by the go.mod file data,
+// or "" if there is none.
+//
+func modulePath(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		if f := strings.Fields(line); len(f) == 2 && f[0] == "module" {
+			if mod, err := strconv.Unquote(f[1]); err == nil {
+				return mod
+			}
+			return f[1]
+		}
+	}
+	return ""
+}
+
+// ----------------------------------------------------------------------------
+// Macros
+
+// maxMacroDepth is the maximum nesting of macro expansions, which stops
+// the expansion of recursive macros.
+const maxMacroDepth = 100
+
+// A macroDef is a macro declaration, with the imports of its file.
+type macroDef struct {
+	decl    *ast.MacroDecl
+	imports map[string]string // package name -> import path
+}
+
+// declareMacros records the macros declared in src and in the other
+// files of its package.
+//
+func (p *printer) declareMacros(src *ast.File) {
+	p.macros = make(map[string]*macroDef)
+	for _, f := range append([]*ast.File{src}, p.PkgFiles...) {
+		var imports map[string]string
+		for _, d := range f.Decls {
+			d, isMacro := d.(*ast.MacroDecl)
+			if !isMacro {
+				continue
+			}
+			if m, found := p.macros[d.Name.Name]; found {
+				p.errorf(d.Name.Pos(), "macro %s redeclared", d.Name.Name)
+				p.errorf(m.decl.Name.Pos(), "other declaration of %s", d.Name.Name)
+				continue
+			}
+			if imports == nil {
+				imports = fileImports(f)
+			}
+			p.macros[d.Name.Name] = &macroDef{decl: d, imports: imports}
+		}
+	}
+}
+
+// fileImports returns the import paths of the packages imported by f,
+// by package name.
+//
+func fileImports(f *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, s := range f.Imports {
+		ipath, err := strconv.Unquote(s.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(ipath)
+		if s.Name != nil {
+			name = s.Name.Name
+		}
+		if name != "_" && name != "." {
+			imports[name] = ipath
+		}
+	}
+	return imports
+}
+
+// macroImports returns the imports of src referred to by its macros, but
+// not used, according to used, by the code printed for src. They are
+// printed as blank imports, so as not to be reported as unused.
+//
+func macroImports(src *ast.File, used map[string]bool) map[*ast.ImportSpec]bool {
+	byMacros := make(map[string]bool)
+	for _, d := range src.Decls {
+		if d, isMacro := d.(*ast.MacroDecl); isMacro {
+			ast.Inspect(d.Body, func(n ast.Node) bool {
+				if x, isSel := n.(*ast.SelectorExpr); isSel {
+					if id, isIdent := x.X.(*ast.Ident); isIdent && id.Obj == nil {
+						byMacros[id.Name] = true
+					}
+				}
+				return true
+			})
+		}
+	}
+	blank := make(map[*ast.ImportSpec]bool)
+	for name, ipath := range fileImports(src) {
+		if byMacros[name] && !used[name] {
+			for _, s := range src.Imports {
+				if s.Path.Value == strconv.Quote(ipath) {
+					blank[s] = true
+				}
+			}
+		}
+	}
+	return blank
+}
+
+// embedImports adds to blank the imports of "embed" in src only needed by
+// its #go:embed directives, which Go requires to be blank imports.
+//
+func embedImports(src *ast.File, used map[string]bool, blank map[*ast.ImportSpec]bool) {
+	embeds := false
+	for _, d := range src.Decls {
+		if d, isGen := d.(*ast.GenDecl); isGen && d.Tok == token.VAR {
+			for _, s := range d.Specs {
+				embeds = embeds || len(s.(*ast.ValueSpec).Embed) > 0
+			}
+		}
+	}
+	if !embeds {
+		return
+	}
+	for _, s := range src.Imports {
+		if s.Path.Value != `"embed"` {
+			continue
+		}
+		if s.Name == nil && !used["embed"] || s.Name != nil && s.Name.Name != "_" && !used[s.Name.Name] {
+			blank[s] = true
+		}
+	}
+}
+
+// hasPreamble reports whether the import declaration d imports "C" with
+// a cgo preamble, which would no longer precede it if other imports were
+// merged into d.
+//
+func hasPreamble(d *ast.GenDecl) bool {
+	for _, s := range d.Specs {
+		if s.(*ast.ImportSpec).Preamble != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// macroFreeComments returns the comments of src but the documentation
+// and the indented comments of its macro declarations, which are not
+// printed.
+//
+func (p *printer) macroFreeComments(src *ast.File) []*ast.CommentGroup {
+	comments := src.Comments
+	for _, d := range src.Decls {
+		d, isMacro := d.(*ast.MacroDecl)
+		if !isMacro {
+			continue
+		}
+		var list []*ast.CommentGroup
+		for _, c := range comments {
+			inBody := d.Pos() < c.Pos() && c.Pos() < d.End() && p.posFor(c.Pos()).Column > 1
+			if c != d.Doc && !inBody {
+				list = append(list, c)
+			}
+		}
+		comments = list
+	}
+	return comments
+}
+
+// errorf records an error at pos.
+func (p *printer) errorf(pos token.Pos, format string, args ...interface{}) {
+	p.errors.Add(p.posFor(pos), fmt.Sprintf(format, args...))
+}
+
+// macroError records the error msg about the expansion of x both at x
+// and at the position pos in the declaration of the macro.
+//
+func (p *printer) macroError(x *ast.MacroExpr, pos token.Pos, msg string) {
+	p.errorf(x.Pos(), "%s!: %s", x.Name.Name, msg)
+	p.errorf(pos, "%s!: %s (expanded at %s)", x.Name.Name, msg, p.posFor(x.Pos()))
+}
+
+// macroExpr prints the expansion of x, which must be an expression.
+func (p *printer) macroExpr(x *ast.MacroExpr, prec1, depth int) {
+	body := p.expand(x)
+	if body == nil {
+		p.print(x.Pos(), "BadExpr")
+		return
+	}
+	s, isExpr := ast.Stmt(nil), false
+	if len(body.List) == 1 {
+		s = body.List[0]
+		_, isExpr = s.(*ast.ExprStmt)
+	}
+	if !isExpr {
+		p.macroError(x, p.macros[x.Name.Name].decl.Body.Pos(), "used as a value, but does not expand to an expression")
+		p.print(x.Pos(), "BadExpr")
+		return
+	}
+	p.macroDepth++
+	p.expr1(s.(*ast.ExprStmt).X, prec1, depth)
+	p.macroDepth--
+}
+
+// macroStmt prints the statements of the expansion of x.
+func (p *printer) macroStmt(x *ast.MacroExpr, nextIsRBrace bool) {
+	body := p.expand(x)
+	if body == nil {
+		p.print(x.Pos(), "BadStmt")
+		return
+	}
+	p.macroDepth++
+	i := 0
+	for _, s := range body.List {
+		if _, isEmpty := s.(*ast.EmptyStmt); !isEmpty {
+			if i > 0 {
+				p.linebreak(p.lineFor(s.Pos()), 1, ignore, false)
+			}
+			p.stmt(s, nextIsRBrace && i == len(body.List)-1)
+			i++
+		}
+	}
+	p.macroDepth--
+	// continue after the invocation
+	p.print(x.End())
+}
+
+// expand returns a copy of the body of the macro invoked by x, with the
+// arguments of x in place of the parameters and the identifiers declared
+// in the body renamed; or nil if x cannot be expanded.
+//
+func (p *printer) expand(x *ast.MacroExpr) *ast.BlockStmt {
+	m := p.macros[x.Name.Name]
+	if m == nil {
+		p.errorf(x.Pos(), "undefined macro %s", x.Name.Name)
+		return nil
+	}
+	if p.macroDepth >= maxMacroDepth {
+		p.macroError(x, m.decl.Pos(), "too many nested expansions")
+		return nil
+	}
+
+	args := x.Args
+	if x.Body != nil {
+		args = append(args[:len(args):len(args)], x.Body)
+	}
+	var params []*ast.Ident
+	var kinds []string
+	for _, f := range m.decl.Params.List {
+		kind := "expr"
+		if id, isIdent := f.Type.(*ast.Ident); isIdent {
+			kind = id.Name
+		}
+		for _, name := range f.Names {
+			params = append(params, name)
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(args) != len(params) {
+		p.macroError(x, m.decl.Params.Pos(), fmt.Sprintf("wrong number of arguments (have %d, want %d)", len(args), len(params)))
+		return nil
+	}
+
+	p.expansions++
+	e := &expansion{
+		p:      p,
+		call:   x,
+		decl:   m.decl,
+		args:   make(map[*ast.Object]ast.Node),
+		suffix: fmt.Sprintf("_%s%d", goName(x.Name), p.expansions),
+	}
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case ast.Expr:
+			if kinds[i] == "stmt" {
+				e.args[params[i].Obj] = &ast.ExprStmt{X: arg}
+			} else {
+				e.args[params[i].Obj] = arg
+			}
+		case ast.Stmt:
+			if kinds[i] != "stmt" {
+				e.error(params[i].Pos(), fmt.Sprintf("cannot use statement as %s argument %s", kinds[i], params[i].Name))
+			}
+			e.args[params[i].Obj] = arg
+		}
+	}
+	delete(e.args, nil) // blank parameters
+	body := e.copy(reflect.ValueOf(m.decl.Body)).Interface().(*ast.BlockStmt)
+	if e.failed {
+		return nil
+	}
+	return body
+}
+
+// An expansion holds the state of the expansion of a macro invocation.
+type expansion struct {
+	p      *printer
+	call   *ast.MacroExpr
+	decl   *ast.MacroDecl
+	args   map[*ast.Object]ast.Node // parameter -> argument; an ast.Stmt for stmt parameters
+	suffix string                   // suffix of the identifiers declared in the body
+	failed bool                     // set if an error was reported
+}
+
+func (e *expansion) error(pos token.Pos, msg string) {
+	e.p.macroError(e.call, pos, msg)
+	e.failed = true
+}
+
+var posType = reflect.TypeOf(token.NoPos)
+
+// copy returns a copy of the macro body node v, or part of it, with the
+// arguments of the expansion in place of the parameters, and with the
+// positions of the invocation.
+//
+func (e *expansion) copy(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		e.set(c, e.copy(v.Elem()), v.Elem())
+		return c
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		switch n := v.Interface().(type) {
+		case *ast.Object, *ast.Scope, *ast.CommentGroup:
+			// not used when printing
+			return reflect.Zero(v.Type())
+		case *ast.Ident:
+			return reflect.ValueOf(e.ident(n))
+		case *ast.ExprStmt:
+			if x, isIdent := n.X.(*ast.Ident); isIdent {
+				if s, isStmt := e.args[x.Obj].(ast.Stmt); isStmt && x.Obj != nil {
+					return reflect.ValueOf(s)
+				}
+			}
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(e.copy(v.Elem()))
+		switch x := c.Interface().(type) {
+		case *ast.KeyValueExpr:
+			if key, isIdent := v.Interface().(*ast.KeyValueExpr).Key.(*ast.Ident); isIdent {
+				// most likely a field name: neither an argument nor renamed
+				x.Key = &ast.Ident{NamePos: e.call.Pos(), Name: key.Name}
+			}
+		case *ast.InterpolatedLit:
+			// the interpolations are found by their offsets in the literal
+			orig := v.Interface().(*ast.InterpolatedLit)
+			for i, y := range x.Exprs {
+				y.Lbrace = x.ValuePos + (orig.Exprs[i].Lbrace - orig.ValuePos)
+				y.Rbrace = x.ValuePos + (orig.Exprs[i].Rbrace - orig.ValuePos)
+			}
+		}
+		return c
+
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			e.set(c.Field(i), e.copy(v.Field(i)), v.Field(i))
+		}
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			e.set(c.Index(i), e.copy(v.Index(i)), v.Index(i))
+		}
+		return c
+	}
+
+	if v.Type() == posType && token.Pos(v.Int()).IsValid() {
+		return reflect.ValueOf(e.call.Pos())
+	}
+	return v
+}
+
+// set sets dst to the copy c of the node orig, unless c is an argument
+// which cannot take the place of orig.
+//
+func (e *expansion) set(dst, c, orig reflect.Value) {
+	if !c.Type().AssignableTo(dst.Type()) {
+		x := orig.Interface().(*ast.Ident)
+		e.error(x.Pos(), fmt.Sprintf("cannot use parameter %s here", x.Name))
+		return
+	}
+	dst.Set(c)
+}
+
+// ident returns the argument for the parameter x, or a copy of x which
+// is renamed if x is declared in the macro body.
+//
+func (e *expansion) ident(x *ast.Ident) ast.Node {
+	if arg, isParam := e.args[x.Obj]; isParam && x.Obj != nil {
+		return arg
+	}
+	name := x.Name
+	if obj := x.Obj; obj != nil && e.decl.Body.Pos() <= obj.Pos() && obj.Pos() < e.decl.Body.End() {
+		name += e.suffix
+	}
+	return &ast.Ident{NamePos: e.call.Pos(), Name: name}
+}
+
+// ----------------------------------------------------------------------------
+// Try expressions
+
+// tryOf returns the try expression lowered by the statement s, or nil.
+// Only a try expression making up an expression statement or the right
+// side of an assignment is lowered.
+//
+func tryOf(s ast.Stmt) *ast.TryExpr {
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		x, _ := s.X.(*ast.TryExpr)
+		return x
+	case *ast.AssignStmt:
+		if len(s.Rhs) == 1 && (s.Tok == token.DEFINE || s.Tok == token.ASSIGN) {
+			x, _ := s.Rhs[0].(*ast.TryExpr)
+			return x
+		}
+	}
+	return nil
+}
+
+// clauseStmt prints the init or post statement s of a control clause,
+// where try expressions cannot be lowered.
+//
+func (p *printer) clauseStmt(s ast.Stmt) {
+	if x := tryOf(s); x != nil {
+		p.errorf(x.Try, "cannot use try in the header of a control statement")
+		p.print(s.Pos(), "BadStmt")
+		return
+	}
+	p.stmt(s, false)
+}
+
+// tryStmt prints the statement s, which lowers the try expression x, with
+// the error result of the call assigned to a new variable, followed by an
+// if statement returning it when it is not nil:
+//
+//	x, err_try1 := f()
+//	if err_try1 != nil {
+//		return 0, err_try1
+//	}
+//
+func (p *printer) tryStmt(s ast.Stmt, x *ast.TryExpr) {
+	var lhs []ast.Expr
+	var tok token.Token
+	if s, isAssign := s.(*ast.AssignStmt); isAssign {
+		lhs, tok = s.Lhs, s.Tok
+	}
+	results := p.tryResults(x, len(lhs))
+	if results == nil {
+		p.print(x.Pos(), "BadStmt")
+		return
+	}
+	p.tries++
+	err := &ast.Ident{NamePos: x.Try, Name: fmt.Sprintf("err_try%d", p.tries)}
+	results[len(results)-1] = err
+
+	if len(lhs) == 0 {
+		// if err_try1 := f(); err_try1 != nil {
+		// with the other results of f discarded
+		p.print(x.Try, token.IF, blank)
+		if d := p.calledFunc(x.X); d != nil {
+			for i := d.Type.Results.NumFields() - 1; i > 0; i-- {
+				p.expr(&ast.Ident{NamePos: x.Try, Name: "_"})
+				p.print(token.COMMA, blank)
+			}
+		}
+		p.expr(err)
+		p.print(blank, token.DEFINE, blank)
+		p.expr(x.X)
+		p.print(token.SEMICOLON, blank)
+	} else {
+		if tok == token.ASSIGN {
+			// the error variable must be declared first
+			p.print(x.Try, token.VAR, blank)
+			p.expr(err)
+			p.print(blank)
+			p.expr(&ast.Ident{NamePos: x.Try, Name: "error"})
+			p.print(newline)
+		}
+		for _, y := range lhs {
+			p.expr(y)
+			p.print(token.COMMA, blank)
+		}
+		p.expr(err)
+		p.print(blank, tok, blank)
+		p.expr(x.X)
+		p.print(newline, token.IF, blank)
+	}
+	p.expr(err)
+	p.print(blank, token.NEQ, blank)
+	p.expr(&ast.Ident{NamePos: x.Try, Name: "nil"})
+	p.print(blank, token.LBRACE, indent, newline)
+	p.stmt(&ast.ReturnStmt{Return: x.Try, Results: results}, true)
+	p.print(unindent, newline, x.End(), token.RBRACE)
+}
+
+// tryResults returns the results returned by the lowering of x, whose
+// values are assigned to n variables, or discarded if n is 0: the named
+// results of the enclosing function or the zero values of its result
+// types, and a nil placeholder for the error. It reports the misuses of
+// x it finds and returns nil.
+//
+// The results of the call are only known if it calls a function declared
+// in the package. Discarding the results of another call is reported, as
+// their number is unknown; when they are assigned, their number and the
+// type of the last one are left to the Go compiler to check.
+//
+func (p *printer) tryResults(x *ast.TryExpr, n int) []ast.Expr {
+	if !endsWithError(p.results) {
+		p.errorf(x.Try, "cannot use try in a function whose last result is not an error")
+		return nil
+	}
+	d := p.calledFunc(x.X)
+	if d == nil && n == 0 {
+		p.errorf(x.X.Pos(), "cannot discard the results of try with a function not declared in the package: assign them")
+		return nil
+	}
+	if d != nil {
+		res := d.Type.Results
+		if !endsWithError(res) {
+			p.errorf(x.X.Pos(), "cannot use try with %s: its last result is not an error", d.Name.Name)
+			return nil
+		}
+		if m := res.NumFields() - 1; m != n && n > 0 {
+			p.errorf(x.X.Pos(), "assignment mismatch: %s but try %s returns %s", plural(n, "variable"), d.Name.Name, plural(m, "value"))
+			return nil
+		}
+	}
+
+	var results []ast.Expr
+	for _, f := range p.results.List {
+		if len(f.Names) == 0 {
+			results = append(results, p.zeroValue(f.Type, x.Try))
+		}
+		for _, name := range f.Names {
+			if name.Name == "_" {
+				results = append(results, p.zeroValue(f.Type, x.Try))
+			} else {
+				results = append(results, &ast.Ident{NamePos: x.Try, Name: name.Name})
+			}
+		}
+	}
+	results[len(results)-1] = nil
+	return results
+}
+
+// endsWithError reports whether the last of the results is an error.
+func endsWithError(results *ast.FieldList) bool {
+	if results == nil || len(results.List) == 0 {
+		return false
+	}
+	id, isIdent := results.List[len(results.List)-1].Type.(*ast.Ident)
+	return isIdent && id.Name == "error"
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// calledFunc returns the declaration of the function called by x if it
+// is declared in the package, or nil.
+//
+func (p *printer) calledFunc(x ast.Expr) *ast.FuncDecl {
+	for {
+		px, isParen := x.(*ast.ParenExpr)
+		if !isParen {
+			break
+		}
+		x = px.X
+	}
+	if call, isCall := x.(*ast.CallExpr); isCall {
+		if id, isIdent := call.Fun.(*ast.Ident); isIdent {
+			if obj := p.lookup(id); obj != nil && obj.Kind == ast.Fun {
+				d, _ := obj.Decl.(*ast.FuncDecl)
+				return d
+			}
+		}
+	}
+	return nil
+}
+
+// lookup returns the object denoted by x, looking it up in the other
+// files of the package if it is not resolved; or nil.
+//
+func (p *printer) lookup(x *ast.Ident) *ast.Object {
+	if x.Obj != nil {
+		return x.Obj
+	}
+	for _, f := range p.PkgFiles {
+		if obj := f.Scope.Lookup(x.Name); obj != nil {
+			return obj
+		}
+	}
+	return nil
+}
+
+// zeroValue returns an expression for the zero value of the type typ,
+// positioned at pos. The zero value of a type whose kind is unknown,
+// such as an imported type, is written *new(T).
+//
+func (p *printer) zeroValue(typ ast.Expr, pos token.Pos) ast.Expr {
+	switch t := typ.(type) {
+	case *ast.ParenExpr:
+		return p.zeroValue(t.X, pos)
+	case *ast.Ident:
+		if x := basicZero(t, pos); x != nil {
+			return x
+		}
+		if obj := p.lookup(t); obj != nil && obj.Kind == ast.Typ {
+			if s, isSpec := obj.Decl.(*ast.TypeSpec); isSpec && s.TypeParams == nil {
+				switch u := s.Type.(type) {
+				case *ast.Ident:
+					if x := basicZero(u, pos); x != nil {
+						return x
+					}
+				case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+					return &ast.Ident{NamePos: pos, Name: "nil"}
+				case *ast.ArrayType:
+					if u.Len == nil {
+						return &ast.Ident{NamePos: pos, Name: "nil"}
+					}
+					return &ast.CompositeLit{Type: relocated(t, pos), Lbrace: pos, Rbrace: pos}
+				case *ast.StructType:
+					return &ast.CompositeLit{Type: relocated(t, pos), Lbrace: pos, Rbrace: pos}
+				}
+			}
+		}
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return &ast.Ident{NamePos: pos, Name: "nil"}
+	case *ast.ArrayType:
+		if t.Len == nil {
+			return &ast.Ident{NamePos: pos, Name: "nil"}
+		}
+		return &ast.CompositeLit{Type: relocated(t, pos), Lbrace: pos, Rbrace: pos}
+	case *ast.StructType:
+		return &ast.CompositeLit{Type: relocated(t, pos), Lbrace: pos, Rbrace: pos}
+	}
+	// *new(T)
+	call := &ast.CallExpr{Fun: &ast.Ident{NamePos: pos, Name: "new"}, Lparen: pos, Args: []ast.Expr{relocated(typ, pos)}, Rparen: pos}
+	return &ast.StarExpr{Star: pos, X: call}
+}
+
+// basicZero returns the zero value of the predeclared type named x, or
+// nil if x is not the name of a predeclared type.
+//
+func basicZero(x *ast.Ident, pos token.Pos) ast.Expr {
+	switch x.Name {
+	case "bool":
+		return &ast.Ident{NamePos: pos, Name: "false"}
+	case "string":
+		return &ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: `""`}
+	case "error", "any":
+		return &ast.Ident{NamePos: pos, Name: "nil"}
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		"byte", "rune", "float32", "float64", "complex64", "complex128":
+		return &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: "0"}
+	}
+	return nil
+}
+
+// relocated returns a copy of the type x with all its positions set to
+// pos, so that it can be printed where it does not appear in the source.
+//
+func relocated(x ast.Expr, pos token.Pos) ast.Expr {
+	return relocate(reflect.ValueOf(x), pos).Interface().(ast.Expr)
+}
+
+func relocate(v reflect.Value, pos token.Pos) reflect.Value {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(relocate(v.Elem(), pos))
+		return c
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		switch v.Interface().(type) {
+		case *ast.Object, *ast.Scope, *ast.CommentGroup:
+			// not used when printing
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(relocate(v.Elem(), pos))
+		return c
+
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			c.Field(i).Set(relocate(v.Field(i), pos))
+		}
+		return c
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(relocate(v.Index(i), pos))
+		}
+		return c
+	}
+
+	if v.Type() == posType && token.Pos(v.Int()).IsValid() {
+		return reflect.ValueOf(pos)
+	}
+	return v
+}
+
+// ----------------------------------------------------------------------------
+// Methods blocks
+
+// methodsDecl prints the functions of the methods block d as the method
+// declarations they are, separated like top-level declarations.
+//
+func (p *printer) methodsDecl(d *ast.MethodsDecl) {
+	for i, f := range d.List {
+		if i > 0 {
+			min := 1
+			if f.Doc != nil {
+				min = 2
+			}
+			p.linebreak(p.lineFor(f.Pos()), min, ignore, false)
+		}
+		p.funcDecl(f)
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Implements
+
+// hasImplements reports whether the declaration d holds implements specs.
+func hasImplements(d *ast.GenDecl) bool {
+	for _, s := range d.Specs {
+		if _, isImpl := s.(*ast.ImplementsSpec); isImpl {
+			return true
+		}
+	}
+	return false
+}
+
+// implementsDecl prints the type declaration d, which holds implements
+// specs, as its type specs followed by an assertion for each interface
+// a type implements.
+//
+func (p *printer) implementsDecl(d *ast.GenDecl) {
+	types, impls := splitImplements(d)
+	min := 1
+	if len(types) > 0 {
+		p.genDecl(&ast.GenDecl{Doc: d.Doc, TokPos: d.TokPos, Tok: d.Tok, Indent: d.Indent, Specs: types, Dedent: d.Dedent})
+		min = 2
+	}
+	for i, impl := range impls {
+		for j, typ := range impl.Types {
+			if i > 0 || j > 0 || len(types) > 0 {
+				p.linebreak(p.lineFor(typ.Pos()), min, ignore, false)
+			}
+			p.assertImplements(impl.Name, typ)
+			min = 1
+		}
+	}
+}
+
+// splitImplements returns the type specs and the implements specs of d.
+func splitImplements(d *ast.GenDecl) (types []ast.Spec, impls []*ast.ImplementsSpec) {
+	for _, s := range d.Specs {
+		if impl, isImpl := s.(*ast.ImplementsSpec); isImpl {
+			impls = append(impls, impl)
+		} else {
+			types = append(types, s)
+		}
+	}
+	return
+}
+
+// assertImplements prints the assertion that the type named name
+// implements the interface typ:
+//
+//	var _ typ = (*name)(nil)
+//
+// The value is positioned at typ, so that the compiler reports a
+// missing method at the interface in the iGo source.
+//
+func (p *printer) assertImplements(name *ast.Ident, typ ast.Expr) {
+	pos := typ.Pos()
+	p.print(pos, token.VAR, blank)
+	p.expr(&ast.Ident{NamePos: pos, Name: "_"})
+	p.print(blank)
+	p.expr(typ)
+	offs := p.commentOffset
+	p.commentOffset = infinity // hold the comments after typ
+	// the positions printed around the start of the value map it to
+	// typ, which is where a missing method is reported
+	p.print(blank, pos, token.ASSIGN, pos-1, blank, token.LPAREN, token.MUL)
+	p.expr(&ast.Ident{Name: name.Name})
+	p.print(token.RPAREN, token.LPAREN)
+	p.expr(ast.NewIdent("nil"))
+	p.print(token.RPAREN)
+	p.commentOffset = offs
+}
+
+// ----------------------------------------------------------------------------
+// Enums
+
+// enumDecl prints the enum declaration d as the declaration of a named
+// integer type, an iota const block for its members, a String method,
+// a function parsing their names and a function returning their values.
+//
+func (p *printer) enumDecl(d *ast.EnumDecl) {
+	for i, decl := range p.enumDecls(d) {
+		if i > 0 {
+			p.linebreak(p.lineFor(decl.Pos()), 2, ignore, true)
+		}
+		if g, isGen := decl.(*ast.GenDecl); isGen && g.Tok == token.CONST {
+			p.enumConsts(g)
+		} else {
+			p.decl(decl)
+		}
+	}
+}
+
+// enumConsts prints the const block d declaring the members of an enum.
+// Like valueSpec, but the line comment of a member follows the type and
+// value added to it, which are positioned at its name.
+//
+func (p *printer) enumConsts(d *ast.GenDecl) {
+	p.print(d.Pos(), token.CONST, blank, d.Indent, token.LPAREN, indent, formfeed)
+	keepType := keepTypeColumn(d.Specs)
+	for i, s := range d.Specs {
+		s := s.(*ast.ValueSpec)
+		if i > 0 {
+			p.linebreak(p.lineFor(s.Pos()), 1, ignore, false)
+		}
+		p.expr(s.Names[0])
+		offs := p.commentOffset
+		p.commentOffset = infinity // hold the comments after the name
+		extraTabs := 3
+		if s.Type != nil || keepType[i] {
+			p.print(vtab)
+			extraTabs--
+		}
+		if s.Type != nil {
+			p.expr(s.Type)
+		}
+		if s.Values != nil {
+			p.print(vtab, token.ASSIGN, blank)
+			p.expr(s.Values[0])
+			extraTabs--
+		}
+		p.commentOffset = offs
+		if s.Comment != nil {
+			for ; extraTabs > 0; extraTabs-- {
+				p.print(vtab)
+			}
+		}
+	}
+	p.print(unindent, formfeed, d.Dedent, token.RPAREN)
+}
+
+// enumDecls returns the Go declarations lowering d. For an enum Color
+// with members Red and Green = 10, these are
+//
+//	type Color int
+//
+//	const (
+//		Red   Color = iota
+//		Green Color = 10
+//	)
+//
+//	func (c Color) String() string { ... }
+//
+//	func ParseColor(s string) (Color, error) { ... }
+//
+//	func ColorValues() []Color { ... }
+//
+// A member without a value is one more than the member before it. Of
+// the members with the same value, such as aliases, only the first one
+// is a case of String and an element of ColorValues.
+//
+// The values function is named after the type, as ParseColor is: a
+// plain Values function would clash with the one of any other enum of
+// the package, and a method would need a Color to be called on.
+//
+func (p *printer) enumDecls(d *ast.EnumDecl) []ast.Decl {
+	// the generated code is positioned at the enum name, but for its
+	// last lines, positioned at the last member
+	pos, end := d.Name.Pos(), d.Name.Pos()
+	if n := len(d.Members); n > 0 {
+		end = d.Members[n-1].Pos()
+	}
+	ident := func(pos token.Pos, name string) *ast.Ident { return &ast.Ident{NamePos: pos, Name: name} }
+	str := func(pos token.Pos, s string) *ast.BasicLit {
+		return &ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: strconv.Quote(s)}
+	}
+	fields := func(names []*ast.Ident, types ...ast.Expr) *ast.FieldList {
+		list := new(ast.FieldList)
+		for _, t := range types {
+			list.List = append(list.List, &ast.Field{Names: names, Type: t})
+		}
+		return list
+	}
+	body := func(closing token.Pos, list ...ast.Stmt) *ast.BlockStmt {
+		return &ast.BlockStmt{Opening: pos, List: list, Closing: closing}
+	}
+	typ, fresh := goName(d.Name), freshNames(d)
+
+	underlying := d.Type
+	if underlying == nil {
+		underlying = ident(pos, "int")
+	}
+	decls := []ast.Decl{&ast.GenDecl{
+		Doc:    d.Doc,
+		TokPos: d.Enum,
+		Tok:    token.TYPE,
+		Specs:  []ast.Spec{&ast.TypeSpec{Name: d.Name, Type: underlying}},
+	}}
+
+	var specs []ast.Spec
+	var names []*ast.Ident    // of the members, but the blank ones
+	var distinct []*ast.Ident // of the names, but those of values already named
+	explicit, last := false, 0
+	values := enumValues(d)
+	named := make(map[int64]bool)
+	for i, m := range d.Members {
+		at := m.Pos()
+		spec := &ast.ValueSpec{Doc: m.Doc, Names: m.Names, Comment: m.Comment}
+		switch {
+		case len(m.Values) > 0:
+			spec.Type, spec.Values = ident(at, typ), m.Values
+			explicit, last = true, i
+		case i == 0:
+			spec.Type, spec.Values = ident(at, typ), []ast.Expr{ident(at, "iota")}
+		case explicit:
+			spec.Type, spec.Values = ident(at, typ), []ast.Expr{enumValue(d.Members[last], last, at)}
+			explicit = false
+		}
+		specs = append(specs, spec)
+		if m.Names[0].Name == "_" {
+			continue
+		}
+		names = append(names, m.Names[0])
+		if v, known := values[i]; !known || !named[v] {
+			distinct = append(distinct, m.Names[0])
+			if known {
+				named[v] = true
+			}
+		}
+	}
+	if len(specs) > 0 {
+		decls = append(decls, &ast.GenDecl{TokPos: d.Indent, Tok: token.CONST, Indent: d.Indent, Specs: specs, Dedent: d.Dedent})
+	}
+
+	// String method
+	recv := ident(pos, fresh(strings.ToLower(typ[:1])))
+	var clauses []ast.Stmt
+	for _, name := range distinct {
+		clauses = append(clauses, &ast.CaseClause{
+			List: []ast.Expr{ident(pos, name.Name)},
+			Body: []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{str(pos, goName(name))}}},
+		})
+	}
+	decls = append(decls, &ast.FuncDecl{
+		Recv: fields([]*ast.Ident{recv}, ident(pos, typ)),
+		Name: ident(pos, "String"),
+		Type: &ast.FuncType{Func: pos, Params: new(ast.FieldList), Results: fields(nil, ident(pos, "string"))},
+		Body: body(end,
+			&ast.SwitchStmt{Tag: recv, Body: body(pos, clauses...)},
+			&ast.ReturnStmt{Results: []ast.Expr{&ast.CallExpr{
+				Fun:  p.qualifiedName("fmt", "Sprintf", end),
+				Args: []ast.Expr{str(end, typ+"(%d)"), ident(end, recv.Name)},
+			}}},
+		),
+	})
+
+	// parsing function
+	param := ident(pos, fresh("s"))
+	clauses = nil
+	for _, name := range names {
+		clauses = append(clauses, &ast.CaseClause{
+			List: []ast.Expr{str(pos, goName(name))},
+			Body: []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{ident(pos, name.Name), ident(pos, "nil")}}},
+		})
+	}
+	decls = append(decls, &ast.FuncDecl{
+		Name: ident(pos, exported(d.Name, "parse", "")),
+		Type: &ast.FuncType{
+			Func:    pos,
+			Params:  fields([]*ast.Ident{param}, ident(pos, "string")),
+			Results: fields(nil, ident(pos, typ), ident(pos, "error")),
+		},
+		Body: body(end,
+			&ast.SwitchStmt{Tag: param, Body: body(pos, clauses...)},
+			&ast.ReturnStmt{Results: []ast.Expr{
+				&ast.BasicLit{ValuePos: end, Kind: token.INT, Value: "0"},
+				&ast.CallExpr{
+					Fun:  p.qualifiedName("fmt", "Errorf", end),
+					Args: []ast.Expr{str(end, "invalid "+typ+" %q"), ident(end, param.Name)},
+				},
+			}},
+		),
+	})
+
+	// values function
+	var elts []ast.Expr
+	for _, name := range distinct {
+		elts = append(elts, ident(end, name.Name))
+	}
+	decls = append(decls, &ast.FuncDecl{
+		Name: ident(pos, exported(d.Name, "", "Values")),
+		Type: &ast.FuncType{Func: pos, Params: new(ast.FieldList), Results: fields(nil, &ast.ArrayType{Elt: ident(pos, typ)})},
+		Body: body(end, &ast.ReturnStmt{Results: []ast.Expr{
+			&ast.CompositeLit{Type: &ast.ArrayType{Elt: ident(end, typ)}, Elts: elts},
+		}}),
+	})
+
+	return decls
+}
+
+// enumValues returns the values of the members of d which are known, by
+// their index: those given by an integer constant expression of literals
+// and members before, and those following a member with a known value.
+//
+func enumValues(d *ast.EnumDecl) map[int]int64 {
+	values := make(map[int]int64)
+	byName := make(map[string]int64)
+	for i, m := range d.Members {
+		switch v := m.Values; {
+		case len(v) == 0 && i == 0:
+			values[i] = 0
+		case len(v) == 0:
+			if prev, known := values[i-1]; known {
+				values[i] = prev + 1
+			}
+		default:
+			if x := constExpr(v[0], byName); x.Kind() == constant.Int {
+				if x, exact := constant.Int64Val(x); exact {
+					values[i] = x
+				}
+			}
+		}
+		if x, known := values[i]; known && m.Names[0].Name != "_" {
+			byName[m.Names[0].Name] = x
+		}
+	}
+	return values
+}
+
+// constOps maps the operators of integer constant expressions to those
+// of go/constant.
+var constOps = map[token.Token]gotoken.Token{
+	token.ADD:     gotoken.ADD,
+	token.SUB:     gotoken.SUB,
+	token.MUL:     gotoken.MUL,
+	token.QUO:     gotoken.QUO_ASSIGN, // integer division
+	token.REM:     gotoken.REM,
+	token.AND:     gotoken.AND,
+	token.OR:      gotoken.OR,
+	token.XOR:     gotoken.XOR,
+	token.SHL:     gotoken.SHL,
+	token.SHR:     gotoken.SHR,
+	token.AND_NOT: gotoken.AND_NOT,
+}
+
+// constExpr returns the value of the integer constant expression x, made
+// of integer literals and the names in byName, or an unknown value.
+//
+func constExpr(x ast.Expr, byName map[string]int64) constant.Value {
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		if x.Kind == token.INT {
+			return constant.MakeFromLiteral(x.Value, gotoken.INT, 0)
+		}
+	case *ast.Ident:
+		if v, known := byName[x.Name]; known {
+			return constant.MakeInt64(v)
+		}
+	case *ast.ParenExpr:
+		return constExpr(x.X, byName)
+	case *ast.UnaryExpr:
+		if op, ok := constOps[x.Op]; ok && (op == gotoken.ADD || op == gotoken.SUB || op == gotoken.XOR) {
+			if y := constExpr(x.X, byName); y.Kind() == constant.Int {
+				return constant.UnaryOp(op, y, 0)
+			}
+		}
+	case *ast.BinaryExpr:
+		a, b := constExpr(x.X, byName), constExpr(x.Y, byName)
+		op, ok := constOps[x.Op]
+		if !ok || a.Kind() != constant.Int || b.Kind() != constant.Int {
+			break
+		}
+		switch op {
+		case gotoken.SHL, gotoken.SHR:
+			if n, exact := constant.Uint64Val(b); exact && n < 64 {
+				return constant.Shift(a, op, uint(n))
+			}
+		case gotoken.QUO_ASSIGN, gotoken.REM:
+			if constant.Sign(b) != 0 {
+				return constant.BinaryOp(a, op, b)
+			}
+		default:
+			return constant.BinaryOp(a, op, b)
+		}
+	}
+	return constant.MakeUnknown()
+}
+
+// enumValue returns the value, positioned at pos, of the members
+// following the i-th member m of an enum, whose value V is explicit:
+// iota + (V) - i, folded if V is an integer literal.
+//
+func enumValue(m *ast.ValueSpec, i int, pos token.Pos) ast.Expr {
+	iota := &ast.Ident{NamePos: pos, Name: "iota"}
+	v := m.Values[0]
+	if lit, isLit := v.(*ast.BasicLit); isLit && lit.Kind == token.INT {
+		if x, err := strconv.ParseInt(lit.Value, 0, 64); err == nil {
+			switch k := x - int64(i); {
+			case k > 0:
+				return &ast.BinaryExpr{X: iota, OpPos: pos, Op: token.ADD, Y: &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: strconv.FormatInt(k, 10)}}
+			case k < 0:
+				return &ast.BinaryExpr{X: iota, OpPos: pos, Op: token.SUB, Y: &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: strconv.FormatInt(-k, 10)}}
+			}
+			return iota
+		}
+	}
+	sum := &ast.BinaryExpr{X: iota, OpPos: pos, Op: token.ADD, Y: &ast.ParenExpr{Lparen: pos, X: v, Rparen: pos}}
+	if i == 0 {
+		return sum
+	}
+	return &ast.BinaryExpr{X: sum, OpPos: pos, Op: token.SUB, Y: &ast.BasicLit{ValuePos: pos, Kind: token.INT, Value: strconv.Itoa(i)}}
+}
+
+// exported returns the name of an enum function, made of its enum's
+// name between prefix and suffix, exported if the enum is.
+//
+func exported(name *ast.Ident, prefix, suffix string) string {
+	s := goName(name)
+	if prefix != "" {
+		s = prefix + strings.ToUpper(s[:1]) + s[1:]
+		if name.IsExported() {
+			s = strings.ToUpper(s[:1]) + s[1:]
+		}
+	}
+	return s + suffix
+}
+
+// freshNames returns a function renaming the given name until it names
+// none of the members of d.
+//
+func freshNames(d *ast.EnumDecl) func(string) string {
+	taken := map[string]bool{d.Name.Name: true}
+	for _, m := range d.Members {
+		taken[m.Names[0].Name] = true
+	}
+	return func(name string) string {
+		for taken[name] {
+			name += "_"
+		}
+		return name
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Go and defer bodies
+
+// bodyCall returns the function literal called by the go or defer
+// statement at pos, if the statement was written with a body instead
+// of a call, or nil.
+//
+func bodyCall(pos token.Pos, call *ast.CallExpr) *ast.FuncLit {
+	if lit, isLit := call.Fun.(*ast.FuncLit); isLit && lit.Type.Func == pos {
+		return lit
+	}
+	return nil
+}
+
+// loopVars returns the variables declared by the for statement s.
+func loopVars(s ast.Stmt) []*ast.Object {
+	var list []*ast.Object
+	add := func(xs ...ast.Expr) {
+		for _, x := range xs {
+			if x, isIdent := x.(*ast.Ident); isIdent && x.Obj != nil && x.Name != "_" {
+				list = append(list, x.Obj)
+			}
+		}
+	}
+	switch s := s.(type) {
+	case *ast.ForStmt:
+		if init, isAssign := s.Init.(*ast.AssignStmt); isAssign && init.Tok == token.DEFINE {
+			add(init.Lhs...)
+		}
+	case *ast.RangeStmt:
+		if s.Tok == token.DEFINE {
+			add(s.Key, s.Value)
+		}
+	}
+	return list
+}
+
+// copyLoopVars prints, before the go or defer statement at pos with a
+// body, a copy of each variable of the enclosing loops the body refers
+// to, so that the body sees the values of its own iteration. The copies
+// are scoped to a block holding the statement, which the caller closes
+// if copyLoopVars returns true, as the loop body may still change the
+// variables after it:
+//
+//	for i := 0; i < n; i++ {
+//		{
+//			i := i
+//			go func() {
+//				use(i)
+//			}()
+//		}
+//		i++
+//	}
+//
+func (p *printer) copyLoopVars(pos token.Pos, call *ast.CallExpr) (scoped bool) {
+	lit := bodyCall(pos, call)
+	if lit == nil || len(p.loops) == 0 {
+		return false
+	}
+	loop := make(map[*ast.Object]bool)
+	for _, obj := range p.loops {
+		loop[obj] = true
+	}
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		if x, isIdent := n.(*ast.Ident); isIdent && loop[x.Obj] {
+			loop[x.Obj] = false // copied once
+			if !scoped {
+				p.print(pos, token.LBRACE, indent, newline)
+				scoped = true
+			}
+			p.expr(&ast.Ident{NamePos: pos, Name: x.Name})
+			p.print(blank, token.DEFINE, blank)
+			p.expr(&ast.Ident{NamePos: pos, Name: x.Name})
+			p.print(newline)
+		}
+		return true
+	})
+	return scoped
+}
+
+// ----------------------------------------------------------------------------
+// Go regions
+
+// verbatimDecl prints the Go source lines of the go! region d as they
+// are, without the indentation of the first one, each at the position
+// of its first character so that the Go output maps back to d.
+//
+func (p *printer) verbatimDecl(d *ast.VerbatimDecl) {
+	lines := strings.Split(d.Text, "\n")
+	if len(lines) < 2 {
+		return // no Go source, as reported by the parser
+	}
+	offs := len(lines[0]) + 1 // offset of the line in d.Text
+	lines = lines[1:]
+	prefix := lines[0][:len(lines[0])-len(strings.TrimLeft(lines[0], " \t"))]
+	// the first line takes the place of the "go!" line; comments and
+	// line breaks are written before moving to the position of a line
+	at := p.posFor(d.Pos())
+	comments := p.commentBefore(at)
+	p.flush(at, token.ILLEGAL)
+	if n := nlimit(at.Line - p.pos.Line); comments && n > 0 {
+		p.writeByte('\n', n)
+	}
+	for i, line := range lines {
+		if i > 0 {
+			p.print(newline)
+			p.flush(p.pos, token.ILLEGAL)
+		}
+		// lines not starting with prefix are blank
+		if strings.HasPrefix(line, prefix) && len(line) > len(prefix) {
+			p.print(d.Go+token.Pos(offs+len(prefix)), strings.TrimSuffix(line[len(prefix):], "\r"))
+		}
+		offs += len(line) + 1
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Comprehensions
+
+// comprehension prints the comprehension x as a function literal called
+// in place, which builds the slice or map with a preallocated result:
+//
+//	func() []string {
+//		r := make([]string, 0, len(users))
+//		for _, u := range users {
+//			if u.Active {
+//				r = append(r, u.Name)
+//			}
+//		}
+//		return r
+//	}()
+//
+// The ranged value is assigned to a variable first unless it is a name.
+// The result is preallocated only if len counts the iterations, that is
+// for arrays, slices, strings and maps. A single variable ranging over a
+// channel, an integer or a function is the one Go declares first.
+//
+func (p *printer) comprehension(x *ast.ComprehensionExpr) {
+	kv, isMap := x.Elt.(*ast.KeyValueExpr)
+	typ := x.Type
+	if typ == nil {
+		typ = p.comprehensionType(x, true)
+	} else if p.checkComprehension(x, isMap) {
+		typ = nil
+	}
+	if typ == nil {
+		p.print(x.Pos(), "BadExpr")
+		return
+	}
+	offs := p.commentOffset
+	p.commentOffset = infinity // hold the comments inside x
+
+	fresh := freshCompNames(x)
+	res := &ast.Ident{NamePos: x.Lbrack, Name: fresh("r")}
+	src := x.X
+	first, hasLen := p.rangeOf(x.X)
+	p.print(x.Lbrack, token.FUNC, token.LPAREN, token.RPAREN, blank)
+	p.expr(typ)
+	p.print(blank, token.LBRACE, indent, newline)
+	if hasLen && !isName(x.X) {
+		src = &ast.Ident{NamePos: x.X.Pos(), Name: fresh("s")}
+		p.expr(src)
+		p.print(blank, token.DEFINE, blank)
+		p.expr(x.X)
+		p.print(newline)
+		src = &ast.Ident{NamePos: x.In, Name: src.(*ast.Ident).Name}
+	}
+
+	// r := make(T, 0, len(s))
+	args := []ast.Expr{relocated(typ, x.Lbrack)}
+	if !isMap {
+		args = append(args, &ast.BasicLit{ValuePos: x.Lbrack, Kind: token.INT, Value: "0"})
+	}
+	if hasLen {
+		args = append(args, &ast.CallExpr{Fun: &ast.Ident{NamePos: x.Lbrack, Name: "len"}, Lparen: x.Lbrack, Args: []ast.Expr{relocated(src, x.Lbrack)}, Rparen: x.Lbrack})
+	}
+	p.expr(res)
+	p.print(blank, token.DEFINE, blank)
+	p.expr(&ast.CallExpr{Fun: &ast.Ident{NamePos: x.Lbrack, Name: "make"}, Lparen: x.Lbrack, Args: args, Rparen: x.Lbrack})
+	p.print(newline)
+
+	// for k, v := range s {
+	p.print(x.For, token.FOR, blank)
+	key, value := x.Key, x.Value
+	if !usesVar(x, value) {
+		value = nil
+	}
+	if key != nil && !usesVar(x, key) {
+		key = &ast.Ident{NamePos: key.NamePos, Name: "_"}
+	}
+	if key == nil && first {
+		key, value = value, nil
+	}
+	if key == nil && value != nil {
+		key = &ast.Ident{NamePos: x.For, Name: "_"}
+	}
+	if key != nil && key.Name != "_" || value != nil {
+		p.expr(key)
+		if value != nil {
+			p.print(token.COMMA, blank)
+			p.expr(value)
+		}
+		p.print(blank, token.DEFINE, blank)
+	}
+	p.print(token.RANGE, blank)
+	p.expr(src)
+	p.print(blank, token.LBRACE, indent, newline)
+	if x.Cond != nil {
+		p.print(x.If, token.IF, blank)
+		p.expr(x.Cond)
+		p.print(blank, token.LBRACE, indent, newline)
+	}
+
+	if isMap {
+		// r[k] = v
+		p.expr(&ast.IndexExpr{X: relocated(res, kv.Pos()), Lbrack: kv.Pos(), Index: kv.Key, Rbrack: kv.Colon})
+		p.print(blank, kv.Colon, token.ASSIGN, blank)
+		p.expr(kv.Value)
+	} else {
+		// r = append(r, e)
+		pos := x.Elt.Pos()
+		p.expr(relocated(res, pos))
+		p.print(blank, token.ASSIGN, blank)
+		p.expr(&ast.CallExpr{Fun: &ast.Ident{NamePos: pos, Name: "append"}, Lparen: pos, Args: []ast.Expr{relocated(res, pos), x.Elt}, Rparen: x.Elt.End()})
+	}
+
+	if x.Cond != nil {
+		p.print(unindent, newline, token.RBRACE)
+	}
+	p.print(unindent, newline, token.RBRACE, newline, x.Rbrack, token.RETURN, blank)
+	p.expr(relocated(res, x.Rbrack))
+	p.print(unindent, newline, token.RBRACE, token.LPAREN, token.RPAREN)
+	p.commentOffset = offs
+}
+
+// isName reports whether x is a name, possibly qualified or selecting a
+// field, which can be evaluated twice.
+//
+func isName(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.Ident:
+		return true
+	case *ast.SelectorExpr:
+		return isName(x.X)
+	}
+	return false
+}
+
+// usesVar reports whether the element or the condition of the
+// comprehension x refers to its variable v.
+//
+func usesVar(x *ast.ComprehensionExpr, v *ast.Ident) bool {
+	if v.Name == "_" {
+		return false
+	}
+	used := false
+	ast.Inspect(x, func(n ast.Node) bool {
+		if id, isIdent := n.(*ast.Ident); isIdent && id != v && id.Obj == v.Obj {
+			used = true
+		}
+		return !used && n != x.X
+	})
+	return used
+}
+
+// freshCompNames returns a function renaming the given name until it is
+// none of the names used in the comprehension x.
+//
+func freshCompNames(x *ast.ComprehensionExpr) func(string) string {
+	taken := make(map[string]bool)
+	ast.Inspect(x, func(n ast.Node) bool {
+		if id, isIdent := n.(*ast.Ident); isIdent {
+			taken[id.Name] = true
+		}
+		return true
+	})
+	return func(name string) string {
+		for taken[name] {
+			name += "_"
+		}
+		taken[name] = true
+		return name
+	}
+}
+
+// checkComprehension reports the mismatch between the explicit type of
+// the comprehension x and its element, a key: value pair if isMap, and
+// whether it found one.
+//
+func (p *printer) checkComprehension(x *ast.ComprehensionExpr, isMap bool) bool {
+	switch p.underlying(x.Type).(type) {
+	case *ast.MapType:
+		if !isMap {
+			p.errorf(x.Elt.Pos(), "missing key in map comprehension")
+			return true
+		}
+	case *ast.ArrayType:
+		if isMap {
+			p.errorf(x.Elt.Pos(), "unexpected key: value in slice comprehension")
+			return true
+		}
+	}
+	return false
+}
+
+// comprehensionType returns the type of the comprehension x, []E or
+// map[K]V, inferred from its element; or nil, reporting it if report is
+// set, when the element type does not follow from the syntax and the
+// declarations of the package.
+//
+func (p *printer) comprehensionType(x *ast.ComprehensionExpr, report bool) ast.Expr {
+	if x.Type != nil {
+		return x.Type
+	}
+	if kv, isKV := x.Elt.(*ast.KeyValueExpr); isKV {
+		key, _ := p.typeOf(kv.Key)
+		value, _ := p.typeOf(kv.Value)
+		switch {
+		case key == nil:
+			if report {
+				p.errorf(kv.Key.Pos(), "cannot infer the key type of the comprehension; write its type, as in map[K]V{k: v for ...}")
+			}
+		case value == nil:
+			if report {
+				p.errorf(kv.Value.Pos(), "cannot infer the value type of the comprehension; write its type, as in map[K]V{k: v for ...}")
+			}
+		default:
+			return &ast.MapType{Map: x.Lbrack, Key: relocated(key, x.Lbrack), Value: relocated(value, x.Lbrack)}
+		}
+		return nil
+	}
+	elt, _ := p.typeOf(x.Elt)
+	if elt == nil {
+		if report {
+			p.errorf(x.Elt.Pos(), "cannot infer the element type of the comprehension; write its type, as in []T{x for ...}")
+		}
+		return nil
+	}
+	return &ast.ArrayType{Lbrack: x.Lbrack, Elt: relocated(elt, x.Lbrack)}
+}
+
+// untypedRank orders the default types of untyped constants: the type
+// of an operation on two untyped constants is the one ranked higher.
+//
+var untypedRank = map[string]int{"int": 1, "rune": 2, "float64": 3, "complex128": 4}
+
+var basicLitTypes = map[token.Token]string{
+	token.INT:    "int",
+	token.FLOAT:  "float64",
+	token.IMAG:   "complex128",
+	token.CHAR:   "rune",
+	token.STRING: "string",
+}
+
+// typeOf returns the type of x as far as it follows from the syntax and
+// the declarations of the package, or nil; untyped reports whether x is
+// an untyped constant, whose type is then its default type.
+//
+func (p *printer) typeOf(x ast.Expr) (typ ast.Expr, untyped bool) {
+	named := func(name string) ast.Expr { return &ast.Ident{Name: name} }
+	switch x := x.(type) {
+	case *ast.BasicLit:
+		return named(basicLitTypes[x.Kind]), true
+	case *ast.InterpolatedLit:
+		return named("string"), false
+	case *ast.CompositeLit:
+		return x.Type, false
+	case *ast.FuncLit:
+		return x.Type, false
+	case *ast.ComprehensionExpr:
+		return p.comprehensionType(x, false), false
+	case *ast.ParenExpr:
+		return p.typeOf(x.X)
+	case *ast.Ident:
+		if (x.Name == "true" || x.Name == "false") && p.lookup(x) == nil {
+			return named("bool"), true
+		}
+		return p.declaredType(x)
+	case *ast.SelectorExpr:
+		if t, _ := p.typeOf(x.X); t != nil {
+			return p.fieldType(t, x.Sel.Name), false
+		}
+	case *ast.IndexExpr:
+		t, _ := p.typeOf(x.X)
+		switch u := p.underlying(t).(type) {
+		case *ast.ArrayType:
+			return u.Elt, false
+		case *ast.MapType:
+			return u.Value, false
+		case *ast.Ident:
+			if u.Name == "string" {
+				return named("byte"), false
+			}
+		}
+	case *ast.SliceExpr:
+		t, _ := p.typeOf(x.X)
+		return t, false
+	case *ast.StarExpr:
+		if t, _ := p.typeOf(x.X); t != nil {
+			if ptr, isPtr := p.underlying(t).(*ast.StarExpr); isPtr {
+				return ptr.X, false
+			}
+		}
+	case *ast.UnaryExpr:
+		switch x.Op {
+		case token.NOT:
+			_, untyped := p.typeOf(x.X)
+			return named("bool"), untyped
+		case token.AND:
+			if t, _ := p.typeOf(x.X); t != nil {
+				return &ast.StarExpr{X: t}, false
+			}
+		case token.ADD, token.SUB, token.XOR:
+			return p.typeOf(x.X)
+		case token.ARROW:
+			t, _ := p.typeOf(x.X)
+			if ch, isChan := p.underlying(t).(*ast.ChanType); isChan {
+				return ch.Value, false
+			}
+		}
+	case *ast.BinaryExpr:
+		switch x.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+			return named("bool"), false
+		case token.LAND, token.LOR:
+			_, lu := p.typeOf(x.X)
+			_, ru := p.typeOf(x.Y)
+			return named("bool"), lu && ru
+		case token.SHL, token.SHR:
+			return p.typeOf(x.X)
+		}
+		l, lu := p.typeOf(x.X)
+		r, ru := p.typeOf(x.Y)
+		switch {
+		case l == nil || r == nil:
+			return nil, false
+		case lu && ru:
+			if untypedRank[r.(*ast.Ident).Name] > untypedRank[l.(*ast.Ident).Name] {
+				return r, true
+			}
+			return l, true
+		case lu:
+			return r, false
+		}
+		return l, false
+	case *ast.CallExpr:
+		return p.resultType(x), false
+	case *ast.TypeAssertExpr:
+		return x.Type, false
+	case *ast.CondExpr:
+		l, lu := p.typeOf(x.X)
+		r, ru := p.typeOf(x.Y)
+		switch {
+		case l == nil:
+			// an untyped value may be converted to the other one
+			if ru {
+				return nil, false
+			}
+			return r, false
+		case r == nil:
+			if lu {
+				return nil, false
+			}
+			return l, false
+		case lu && ru:
+			if untypedRank[r.(*ast.Ident).Name] > untypedRank[l.(*ast.Ident).Name] {
+				return r, true
+			}
+			return l, true
+		case lu:
+			return r, false
+		}
+		return l, false
+	}
+	return nil, false
+}
+
+// declaredType returns the type of the variable, constant or function x
+// as given by its declaration, or nil.
+//
+func (p *printer) declaredType(x *ast.Ident) (typ ast.Expr, untyped bool) {
+	obj := p.lookup(x)
+	if obj == nil || obj.Kind != ast.Var && obj.Kind != ast.Con && obj.Kind != ast.Fun {
+		return nil, false
+	}
+	switch d := obj.Decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv == nil && d.Type.TypeParams == nil {
+			return d.Type, false
+		}
+	case *ast.Field:
+		if e, isEllipsis := d.Type.(*ast.Ellipsis); isEllipsis {
+			return &ast.ArrayType{Elt: e.Elt}, false
+		}
+		return d.Type, false
+	case *ast.ValueSpec:
+		if d.Type != nil {
+			return d.Type, false
+		}
+		for i, name := range d.Names {
+			if name.Obj == obj && len(d.Values) == len(d.Names) {
+				return p.typeOf(d.Values[i])
+			}
+		}
+	case *ast.AssignStmt:
+		for i, lhs := range d.Lhs {
+			if id, isIdent := lhs.(*ast.Ident); !isIdent || id.Obj != obj {
+				continue
+			}
+			if len(d.Rhs) == 1 {
+				if r, isRange := d.Rhs[0].(*ast.UnaryExpr); isRange && r.Op == token.RANGE {
+					return p.rangedType(r.X, i == 0)
+				}
+			}
+			if len(d.Rhs) == len(d.Lhs) {
+				t, _ := p.typeOf(d.Rhs[i])
+				return t, false
+			}
+		}
+	case *ast.ComprehensionExpr:
+		if d.Key == nil {
+			first, _ := p.rangeOf(d.X)
+			return p.rangedType(d.X, first)
+		}
+		return p.rangedType(d.X, d.Key.Obj == obj)
+	}
+	return nil, false
+}
+
+// rangedType returns the type of the key, if isKey is set, or of the value
+// produced by ranging over x; or nil.
+//
+func (p *printer) rangedType(x ast.Expr, isKey bool) (ast.Expr, bool) {
+	t, _ := p.typeOf(x)
+	if values := p.yields(t); len(values) > 0 {
+		if isKey || len(values) == 1 {
+			return values[0], false
+		}
+		return values[1], false
+	}
+	switch u := p.underlying(t).(type) {
+	case *ast.ArrayType:
+		if isKey {
+			return &ast.Ident{Name: "int"}, false
+		}
+		return u.Elt, false
+	case *ast.StarExpr:
+		if a, isArray := p.underlying(u.X).(*ast.ArrayType); isArray && a.Len != nil {
+			if isKey {
+				return &ast.Ident{Name: "int"}, false
+			}
+			return a.Elt, false
+		}
+	case *ast.MapType:
+		if isKey {
+			return u.Key, false
+		}
+		return u.Value, false
+	case *ast.ChanType:
+		return u.Value, false
+	case *ast.Ident:
+		if u.Name == "string" {
+			if isKey {
+				return &ast.Ident{Name: "int"}, false
+			}
+			return &ast.Ident{Name: "rune"}, false
+		}
+		if isInteger(u) {
+			return t, false
+		}
+	}
+	return nil, false
+}
+
+// rangeOf tells how a comprehension ranges over x: first reports whether
+// its single variable is the first one Go declares, as for maps, channels,
+// integers and functions, rather than the element of an array, a slice or
+// a string, or of a value of unknown type; hasLen reports whether len(x)
+// counts the iterations, as for arrays, slices, strings and maps.
+//
+func (p *printer) rangeOf(x ast.Expr) (first, hasLen bool) {
+	t, _ := p.typeOf(x)
+	if values := p.yields(t); len(values) > 0 {
+		return true, false
+	}
+	switch u := p.underlying(t).(type) {
+	case *ast.ArrayType:
+		return false, true
+	case *ast.MapType:
+		return true, true
+	case *ast.StarExpr:
+		if a, isArray := p.underlying(u.X).(*ast.ArrayType); isArray && a.Len != nil {
+			return false, true
+		}
+	case *ast.ChanType:
+		return true, false
+	case *ast.Ident:
+		if u.Name == "string" {
+			return false, true
+		}
+		return isInteger(u), false
+	}
+	return false, false
+}
+
+// yields returns the types of the values produced by ranging over a
+// function of type t, an iter.Seq or an iter.Seq2; or nil.
+//
+func (p *printer) yields(t ast.Expr) []ast.Expr {
+	switch u := p.underlying(t).(type) {
+	case *ast.FuncType:
+		if u.Params.NumFields() != 1 || u.Results.NumFields() != 0 {
+			return nil
+		}
+		yield, isFunc := u.Params.List[0].Type.(*ast.FuncType)
+		if !isFunc || yield.Results.NumFields() != 1 {
+			return nil
+		}
+		var values []ast.Expr
+		for _, f := range yield.Params.List {
+			values = append(values, f.Type)
+			for i := 1; i < len(f.Names); i++ {
+				values = append(values, f.Type)
+			}
+		}
+		return values
+	case *ast.IndexExpr:
+		if p.isIter(u.X, "Seq") {
+			return []ast.Expr{u.Index}
+		}
+	case *ast.IndexListExpr:
+		if p.isIter(u.X, "Seq2") && len(u.Indices) == 2 {
+			return u.Indices
+		}
+	}
+	return nil
+}
+
+// isIter reports whether x is the type name iter.name, the package iter
+// not being shadowed.
+//
+func (p *printer) isIter(x ast.Expr, name string) bool {
+	sel, isSel := x.(*ast.SelectorExpr)
+	if !isSel || sel.Sel.Name != name {
+		return false
+	}
+	id, isIdent := sel.X.(*ast.Ident)
+	return isIdent && id.Name == "iter" && p.lookup(id) == nil
+}
+
+// isInteger reports whether t names a predeclared integer type.
+func isInteger(t *ast.Ident) bool {
+	switch t.Name {
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		"byte", "rune":
+		return true
+	}
+	return false
+}
+
+// underlying returns the type a type declared in the package stands
+// for, following the chain of declarations; any other type is returned
+// as it is.
+//
+func (p *printer) underlying(t ast.Expr) ast.Expr {
+	for i := 0; i < 100; i++ { // bounds invalid cycles
+		id, isIdent := t.(*ast.Ident)
+		if !isIdent {
+			if pt, isParen := t.(*ast.ParenExpr); isParen {
+				t = pt.X
+				continue
+			}
+			return t
+		}
+		obj := p.lookup(id)
+		if obj == nil || obj.Kind != ast.Typ {
+			return t
+		}
+		s, isSpec := obj.Decl.(*ast.TypeSpec)
+		if !isSpec || s.TypeParams != nil {
+			return t
+		}
+		t = s.Type
+	}
+	return t
+}
+
+// fieldType returns the type of the field name of the struct type t, or
+// of the struct t points to, declared in the package; or nil.
+//
+func (p *printer) fieldType(t ast.Expr, name string) ast.Expr {
+	u := p.underlying(t)
+	if ptr, isPtr := u.(*ast.StarExpr); isPtr {
+		u = p.underlying(ptr.X)
+	}
+	st, isStruct := u.(*ast.StructType)
+	if !isStruct || st.Fields == nil {
+		return nil
+	}
+	for _, f := range st.Fields.List {
+		for _, n := range f.Names {
+			if n.Name == name {
+				return f.Type
+			}
+		}
+	}
+	return nil
+}
+
+// resultType returns the type of the result of the call x, if x is a
+// conversion, a call to a builtin function or to a function with a
+// single result declared in the package; or nil.
+//
+func (p *printer) resultType(x *ast.CallExpr) ast.Expr {
+	fun := x.Fun
+	for {
+		px, isParen := fun.(*ast.ParenExpr)
+		if !isParen {
+			break
+		}
+		fun = px.X
+	}
+	if p.isType(fun) {
+		return fun
+	}
+	var ft *ast.FuncType
+	switch f := fun.(type) {
+	case *ast.Ident:
+		obj := p.lookup(f)
+		if obj == nil {
+			switch f.Name {
+			case "len", "cap", "copy":
+				return &ast.Ident{Name: "int"}
+			case "new":
+				if len(x.Args) == 1 {
+					return &ast.StarExpr{X: x.Args[0]}
+				}
+			case "make":
+				if len(x.Args) > 0 {
+					return x.Args[0]
+				}
+			case "append", "min", "max":
+				if len(x.Args) > 0 {
+					t, _ := p.typeOf(x.Args[0])
+					return t
+				}
+			}
+			return nil
+		}
+		switch d := obj.Decl.(type) {
+		case *ast.FuncDecl:
+			if d.Type.TypeParams == nil {
+				ft = d.Type
+			}
+		default:
+			t, _ := p.typeOf(f)
+			ft, _ = p.underlying(t).(*ast.FuncType)
+		}
+	case *ast.FuncLit:
+		ft = f.Type
+	}
+	if ft == nil || ft.Results.NumFields() != 1 {
+		return nil
+	}
+	return ft.Results.List[0].Type
+}
+
+// isType reports whether x is a type expression which does not depend on
+// other packages.
+//
+func (p *printer) isType(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.ArrayType, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType, *ast.StructType:
+		return true
+	case *ast.ParenExpr:
+		return p.isType(x.X)
+	case *ast.StarExpr:
+		return p.isType(x.X)
+	case *ast.Ident:
+		if obj := p.lookup(x); obj != nil {
+			return obj.Kind == ast.Typ
+		}
+		return basicZero(x, token.NoPos) != nil
+	}
+	return false
+}
+
+// ----------------------------------------------------------------------------
+// Conditional expressions
+
+// condOf returns the conditional expression lowered by the statement s
+// into an if statement, or nil: one making up an expression statement,
+// the right side of an assignment, the result of a return statement or
+// the value of a variable declaration. A variable declared first would
+// shadow the one of the same name the conditional may refer to, as in
+// "x := x + 1 if ok else 0", which is then left to condExpr.
+//
+func condOf(s ast.Stmt) *ast.CondExpr {
+	var x ast.Expr
+	var name ast.Expr // the variable declared by s, if any
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		x = s.X
+	case *ast.AssignStmt:
+		if len(s.Rhs) == 1 && (s.Tok != token.DEFINE || len(s.Lhs) == 1) {
+			x = s.Rhs[0]
+			if s.Tok == token.DEFINE {
+				name = s.Lhs[0]
+			}
+		}
+	case *ast.ReturnStmt:
+		if len(s.Results) == 1 {
+			x = s.Results[0]
+		}
+	case *ast.DeclStmt:
+		if d, isGen := s.Decl.(*ast.GenDecl); isGen && d.Tok == token.VAR && len(d.Specs) == 1 {
+			if v := d.Specs[0].(*ast.ValueSpec); len(v.Names) == 1 && len(v.Values) == 1 {
+				x, name = v.Values[0], v.Names[0]
+			}
+		}
+	}
+	c, _ := x.(*ast.CondExpr)
+	if c != nil && name != nil && refersTo(c, name) {
+		return nil
+	}
+	return c
+}
+
+// refersTo reports whether x refers to a name spelled as the identifier
+// name.
+//
+func refersTo(x ast.Expr, name ast.Expr) bool {
+	id, isIdent := name.(*ast.Ident)
+	if !isIdent {
+		return false
+	}
+	found := false
+	ast.Inspect(x, func(n ast.Node) bool {
+		if y, isIdent := n.(*ast.Ident); isIdent && y.Name == id.Name {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// condStmt prints the statement s, which lowers the conditional expression
+// x, as an if statement with s in each branch, taking the value of that
+// branch; a variable declared by s is declared first:
+//
+//	var x int
+//	if ok {
+//		x = a
+//	} else {
+//		x = b
+//	}
+//
+func (p *printer) condStmt(s ast.Stmt, x *ast.CondExpr) {
+	var branch func(y ast.Expr) ast.Stmt
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		branch = func(y ast.Expr) ast.Stmt { return &ast.ExprStmt{X: y} }
+	case *ast.ReturnStmt:
+		branch = func(y ast.Expr) ast.Stmt { return &ast.ReturnStmt{Return: y.Pos(), Results: []ast.Expr{y}} }
+	case *ast.AssignStmt:
+		lhs, tok := s.Lhs, s.Tok
+		if tok == token.DEFINE {
+			if !p.condVar(s.TokPos, lhs[0], nil, x) {
+				return
+			}
+			lhs, tok = []ast.Expr{relocated(lhs[0], s.TokPos)}, token.ASSIGN
+		}
+		branch = func(y ast.Expr) ast.Stmt {
+			return &ast.AssignStmt{Lhs: lhs, TokPos: s.TokPos, Tok: tok, Rhs: []ast.Expr{y}}
+		}
+	case *ast.DeclStmt:
+		d := s.Decl.(*ast.GenDecl)
+		v := d.Specs[0].(*ast.ValueSpec)
+		if !p.condVar(d.TokPos, v.Names[0], v.Type, x) {
+			return
+		}
+		lhs := []ast.Expr{relocated(v.Names[0], x.Pos())}
+		branch = func(y ast.Expr) ast.Stmt {
+			return &ast.AssignStmt{Lhs: lhs, TokPos: x.Pos(), Tok: token.ASSIGN, Rhs: []ast.Expr{y}}
+		}
+	}
+
+	offs := p.commentOffset
+	p.commentOffset = infinity // hold the comments inside s
+	for {
+		p.print(x.If, token.IF, blank)
+		p.expr(x.Cond)
+		p.print(blank, token.LBRACE, indent, newline)
+		p.stmt(branch(x.X), true)
+		p.print(unindent, newline, x.Else, token.RBRACE, blank, token.ELSE, blank)
+		y, isCond := x.Y.(*ast.CondExpr)
+		if !isCond {
+			break
+		}
+		x = y
+	}
+	p.print(token.LBRACE, indent, newline)
+	p.stmt(branch(x.Y), true)
+	p.print(unindent, newline, token.RBRACE)
+	p.commentOffset = offs
+}
+
+// condVar prints the declaration of the variable name taking the value
+// of the conditional expression x, of type typ or, if typ is nil, of the
+// type of x, and reports whether it could.
+//
+func (p *printer) condVar(pos token.Pos, name ast.Expr, typ ast.Expr, x *ast.CondExpr) bool {
+	if typ == nil {
+		if typ = p.condType(x); typ == nil {
+			p.print(pos, "BadStmt")
+			return false
+		}
+	}
+	p.print(pos, token.VAR, blank)
+	p.expr(name)
+	p.print(blank)
+	p.expr(typ)
+	p.print(newline)
+	return true
+}
+
+// condType returns the type of the conditional expression x, positioned
+// at its "if", or nil, reporting that it cannot be inferred.
+//
+func (p *printer) condType(x *ast.CondExpr) ast.Expr {
+	typ, _ := p.typeOf(x)
+	if typ == nil {
+		p.errorf(x.If, "cannot infer the type of the conditional expression; convert one of its values, as in T(a) if cond else b")
+		return nil
+	}
+	return relocated(typ, x.If)
+}
+
+// condExpr prints the conditional expression x as a function literal
+// called in place, so that only the value taken is evaluated:
+//
+//	func() int {
+//		if ok {
+//			return a
+//		}
+//		return b
+//	}()
+//
+func (p *printer) condExpr(x *ast.CondExpr) {
+	typ := p.condType(x)
+	if typ == nil {
+		p.print(x.Pos(), "BadExpr")
+		return
+	}
+	offs := p.commentOffset
+	p.commentOffset = infinity // hold the comments inside x
+
+	p.print(x.Pos(), token.FUNC, token.LPAREN, token.RPAREN, blank)
+	p.expr(typ)
+	p.print(blank, token.LBRACE, indent, newline)
+	for {
+		p.print(x.If, token.IF, blank)
+		p.expr(x.Cond)
+		p.print(blank, token.LBRACE, indent, newline)
+		p.stmt(&ast.ReturnStmt{Return: x.X.Pos(), Results: []ast.Expr{x.X}}, true)
+		p.print(unindent, newline, x.Else, token.RBRACE, newline)
+		y, isCond := x.Y.(*ast.CondExpr)
+		if !isCond {
+			break
+		}
+		x = y
+	}
+	p.stmt(&ast.ReturnStmt{Return: x.Y.Pos(), Results: []ast.Expr{x.Y}}, true)
+	p.print(unindent, newline, token.RBRACE, token.LPAREN, token.RPAREN)
+	p.commentOffset = offs
+}
@@ -112,6 +112,18 @@ func (p *printer) identList(list []*ast.Ident, indent bool) {
 	p.exprList(token.NoPos, xlist, 1, mode, token.NoPos)
 }
 
+// commaPos returns the position to print the comma between the list
+// entries prev and x at: the position of x, unless the next comment lies
+// between them and is set off from x by less space than from prev, as in
+// "a, /* c */ b", where it follows the comma.
+func (p *printer) commaPos(prev, x ast.Expr) token.Pos {
+	if c := p.comment; c != nil && prev.End() <= c.Pos() && c.End() <= x.Pos() &&
+		p.lineFor(prev.End()) == p.lineFor(x.Pos()) && c.Pos()-prev.End() > x.Pos()-c.End() {
+		return prev.End()
+	}
+	return x.Pos()
+}
+
 // Print a list of expressions. If the list spans multiple
 // source lines, the original line breaks are respected between
 // expressions.
@@ -135,7 +147,7 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 			if i > 0 {
 				// use position of expression following the comma as
 				// comma position for correct comment placement
-				p.print(x.Pos(), token.COMMA, blank)
+				p.print(p.commaPos(list[i-1], x), token.COMMA, blank)
 			}
 			p.expr0(x, depth)
 		}
@@ -214,7 +226,7 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 			// comma position for correct comment placement, but
 			// only if the expression is on the same line
 			if !needsLinebreak {
-				p.print(x.Pos())
+				p.print(p.commaPos(list[i-1], x))
 			}
 			p.print(token.COMMA)
 			needsBlank := true
@@ -262,8 +274,20 @@ func (p *printer) exprList(prev0 token.Pos, list []ast.Expr, depth int, mode exp
 	}
 }
 
-func (p *printer) parameters(fields *ast.FieldList) {
-	p.print(fields.Opening, token.LPAREN)
+type paramMode int
+
+const (
+	funcParam paramMode = iota
+	funcTParam
+	typeTParam
+)
+
+func (p *printer) parameters(fields *ast.FieldList, mode paramMode) {
+	openTok, closeTok := token.LPAREN, token.RPAREN
+	if mode != funcParam {
+		openTok, closeTok = token.LBRACK, token.RBRACK
+	}
+	p.print(fields.Opening, openTok)
 	if len(fields.List) > 0 {
 		prevLine := p.lineFor(fields.Opening)
 		ws := indent
@@ -316,18 +340,57 @@ func (p *printer) parameters(fields *ast.FieldList) {
 		if closing := p.lineFor(fields.Closing); 0 < prevLine && prevLine < closing {
 			p.print(token.COMMA)
 			p.linebreak(closing, 0, ignore, true)
+		} else if mode == typeTParam && fields.NumFields() == 1 && combinesWithName(fields.List[0].Type) {
+			// A type parameter list [P T] where the name P and the type expression T
+			// syntactically combine to another valid (value) expression requires a
+			// trailing comma, as in [P *T,], not to be taken for an array length.
+			p.print(token.COMMA)
 		}
 		// unindent if we indented
 		if ws == ignore {
 			p.print(unindent)
 		}
 	}
-	p.print(fields.Closing, token.RPAREN)
+	p.print(fields.Closing, closeTok)
+}
+
+// combinesWithName reports whether a name followed by the expression x
+// syntactically combines to another valid (value) expression. For instance
+// using *T for x, "name *T" syntactically appears as the expression x*T.
+// On the other hand, using P|Q or *P|~Q for x, "name P|Q" or "name *P|~Q"
+// cannot be combined into a valid (value) expression.
+func combinesWithName(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.StarExpr:
+		// name *x.X combines to name*x.X if x.X is not a type element
+		return !isTypeElem(x.X)
+	case *ast.BinaryExpr:
+		return combinesWithName(x.X) && !isTypeElem(x.Y)
+	case *ast.ParenExpr:
+		return combinesWithName(x.X)
+	}
+	return false
+}
+
+// isTypeElem reports whether x is a (possibly parenthesized) type element expression.
+// The result is false if x could be a type element OR an ordinary (value) expression.
+func isTypeElem(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.ArrayType, *ast.StructType, *ast.FuncType, *ast.InterfaceType, *ast.MapType, *ast.ChanType:
+		return true
+	case *ast.UnaryExpr:
+		return x.Op == token.TILDE
+	case *ast.BinaryExpr:
+		return isTypeElem(x.X) || isTypeElem(x.Y)
+	case *ast.ParenExpr:
+		return isTypeElem(x.X)
+	}
+	return false
 }
 
 func (p *printer) signature(params, result *ast.FieldList) {
 	if params != nil {
-		p.parameters(params)
+		p.parameters(params, funcParam)
 	} else {
 		p.print(token.LPAREN, token.RPAREN)
 	}
@@ -340,7 +403,7 @@ func (p *printer) signature(params, result *ast.FieldList) {
 			p.expr(stripParensAlways(result.List[0].Type))
 			return
 		}
-		p.parameters(result)
+		p.parameters(result, funcParam)
 	}
 }
 
@@ -418,7 +481,9 @@ func (p *printer) fieldList(fields *ast.FieldList, isStruct, isIncomplete bool)
 	}
 	// hasComments || !srcIsOneLine
 
-	p.print(blank, lbrace, token.LBRACE, indent)
+	// the opening of an indented list is the first field, so the brace
+	// is not placed there: comments before that field stay with it
+	p.print(blank, token.LBRACE, indent)
 	if hasComments || len(list) > 0 {
 		p.print(formfeed)
 	}
@@ -729,15 +794,40 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 	case *ast.BasicLit:
 		p.print(x)
 
+	case *ast.InterpolatedLit:
+		p.interpolatedLit(x, prec1, depth)
+
+	case *ast.MacroLit:
+		p.macroLit(x)
+
+	case *ast.MacroExpr:
+		p.macroExpr(x, prec1, depth)
+
+	case *ast.ComprehensionExpr:
+		p.comprehension(x)
+
+	case *ast.CondExpr:
+		p.condExpr(x)
+
+	case *ast.TryExpr:
+		p.errorf(x.Try, "try must make up an expression statement or the right side of an assignment")
+		p.print(x.Pos(), "BadExpr")
+
 	case *ast.FuncLit:
 		p.expr(x.Type)
+		results := p.results
+		p.results = x.Type.Results
 		p.adjBlock(p.distanceFrom(x.Type.Pos()), blank, x.Body)
+		p.results = results
 
 	case *ast.ParenExpr:
 		if _, hasParens := x.X.(*ast.ParenExpr); hasParens {
 			// don't print parentheses around an already parenthesized expression
 			// TODO(gri) consider making this more general and incorporate precedence levels
 			p.expr0(x.X, reduceDepth(depth)) // parentheses undo one level of depth
+		} else if c, isCond := x.X.(*ast.CondExpr); isCond {
+			// the function literal called in place needs none
+			p.condExpr(c)
 		} else {
 			p.print(token.LPAREN)
 			p.expr0(x.X, reduceDepth(depth)) // parentheses undo one level of depth
@@ -770,6 +860,13 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		p.expr0(x.Index, depth+1)
 		p.print(x.Rbrack, token.RBRACK)
 
+	case *ast.IndexListExpr:
+		// TODO(gri): as for IndexExpr, should treat [] like parentheses
+		p.expr1(x.X, token.HighestPrec, 1)
+		p.print(x.Lbrack, token.LBRACK)
+		p.exprList(x.Lbrack, x.Indices, depth+1, commaTerm, x.Rbrack)
+		p.print(x.Rbrack, token.RBRACK)
+
 	case *ast.SliceExpr:
 		// TODO(gri): should treat[] like parentheses and undo one level of depth
 		p.expr1(x.X, token.HighestPrec, 1)
@@ -807,6 +904,9 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 			if x.Rparen.IsValid() && p.lineFor(x.Ellipsis) < p.lineFor(x.Rparen) {
 				p.print(token.COMMA, formfeed)
 			}
+		} else if lit, i := p.formatLit(x); lit != nil {
+			args := append(x.Args[:i:i], formatArgs(lit, x.Args[i+1:])...)
+			p.exprList(x.Lparen, args, depth, commaTerm, x.Rparen)
 		} else {
 			p.exprList(x.Lparen, x.Args, depth, commaTerm, x.Rparen)
 		}
@@ -817,12 +917,27 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		if x.Type != nil {
 			p.expr1(x.Type, token.HighestPrec, depth)
 		}
-		p.print(x.Lbrace, token.LBRACE)
+		if x.Block {
+			// the comments ending the line of the type follow the brace
+			p.print(token.LBRACE)
+		} else {
+			p.print(x.Lbrace, token.LBRACE)
+		}
 		p.exprList(x.Lbrace, x.Elts, 1, commaTerm, x.Rbrace)
-		// do not insert extra line breaks because of comments before
-		// the closing '}' as it might break the code if there is no
-		// trailing ','
-		p.print(noExtraLinebreak, x.Rbrace, token.RBRACE, noExtraLinebreak)
+		if x.Block {
+			// each element of an indented literal ends a line, and so
+			// do the comments following the last one; exprList ends
+			// the last line only if the block closes on a later one
+			if len(x.Elts) > 0 && p.pos.Line >= p.lineFor(x.Rbrace) {
+				p.print(token.COMMA, formfeed)
+			}
+			p.print(x.Rbrace, token.RBRACE)
+		} else {
+			// do not insert extra line breaks because of comments before
+			// the closing '}' as it might break the code if there is no
+			// trailing ','
+			p.print(noExtraLinebreak, x.Rbrace, token.RBRACE, noExtraLinebreak)
+		}
 
 	case *ast.Ellipsis:
 		p.print(token.ELLIPSIS)
@@ -923,6 +1038,10 @@ func (p *printer) block(b *ast.BlockStmt, nindent int) {
 		nindent = 0
 		p.noBrace = false
 		p.print(b.Opening)
+	} else if c := p.comment; c != nil && p.commentOffset < p.posFor(b.Opening).Offset &&
+		!isBlockComment(c.List[0]) && p.lineFor(c.Pos()) == p.lineFor(b.Opening) {
+		// a line comment ending the header stays on the line of the "{"
+		p.print(c.Pos(), token.LBRACE)
 	} else {
 		p.print(b.Opening, token.LBRACE)
 	}
@@ -991,7 +1110,7 @@ func (p *printer) controlClause(isForStmt bool, init ast.Stmt, expr ast.Expr, po
 		// all semicolons required
 		// (they are not separators, print them explicitly)
 		if init != nil {
-			p.stmt(init, false)
+			p.clauseStmt(init)
 		}
 		p.print(token.SEMICOLON, blank)
 		if expr != nil {
@@ -1002,7 +1121,7 @@ func (p *printer) controlClause(isForStmt bool, init ast.Stmt, expr ast.Expr, po
 			p.print(token.SEMICOLON, blank)
 			needsBlank = false
 			if post != nil {
-				p.stmt(post, false)
+				p.clauseStmt(post)
 				needsBlank = true
 			}
 		}
@@ -1055,6 +1174,10 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		p.print("BadStmt")
 
 	case *ast.DeclStmt:
+		if x := condOf(s); x != nil {
+			p.condStmt(s, x)
+			break
+		}
 		p.decl(s.Decl)
 
 	case *ast.EmptyStmt:
@@ -1079,6 +1202,18 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		p.stmt(s.Stmt, nextIsRBrace)
 
 	case *ast.ExprStmt:
+		if x, isMacro := s.X.(*ast.MacroExpr); isMacro {
+			p.macroStmt(x, nextIsRBrace)
+			break
+		}
+		if x := tryOf(s); x != nil {
+			p.tryStmt(s, x)
+			break
+		}
+		if x := condOf(s); x != nil {
+			p.condStmt(s, x)
+			break
+		}
 		const depth = 1
 		p.expr0(s.X, depth)
 
@@ -1094,6 +1229,14 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		p.print(s.TokPos, s.Tok)
 
 	case *ast.AssignStmt:
+		if x := tryOf(s); x != nil {
+			p.tryStmt(s, x)
+			break
+		}
+		if x := condOf(s); x != nil {
+			p.condStmt(s, x)
+			break
+		}
 		var depth = 1
 		if len(s.Lhs) > 1 && len(s.Rhs) > 1 {
 			depth++
@@ -1103,14 +1246,26 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		p.exprList(s.TokPos, s.Rhs, depth, 0, token.NoPos)
 
 	case *ast.GoStmt:
+		scoped := p.copyLoopVars(s.Go, s.Call)
 		p.print(token.GO, blank)
 		p.expr(s.Call)
+		if scoped {
+			p.print(unindent, newline, token.RBRACE)
+		}
 
 	case *ast.DeferStmt:
+		scoped := p.copyLoopVars(s.Defer, s.Call)
 		p.print(token.DEFER, blank)
 		p.expr(s.Call)
+		if scoped {
+			p.print(unindent, newline, token.RBRACE)
+		}
 
 	case *ast.ReturnStmt:
+		if x := condOf(s); x != nil {
+			p.condStmt(s, x)
+			break
+		}
 		p.print(token.RETURN)
 		if s.Results != nil {
 			p.print(blank)
@@ -1154,6 +1309,9 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 			}
 		}
 
+	case *ast.PostfixStmt:
+		p.postfixStmt(s)
+
 	case *ast.CaseClause:
 		if s.List != nil {
 			p.print(token.CASE, blank)
@@ -1162,7 +1320,10 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 			p.print(token.DEFAULT)
 		}
 		p.print(s.Colon, token.COLON)
-		p.noBrace = true
+		if len(s.Body) == 1 {
+			// an indented body is printed without braces
+			_, p.noBrace = s.Body[0].(*ast.BlockStmt)
+		}
 		p.stmtList(s.Body, 1, nextIsRBrace)
 
 	case *ast.SwitchStmt:
@@ -1174,7 +1335,7 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		p.print(token.SWITCH)
 		if s.Init != nil {
 			p.print(blank)
-			p.stmt(s.Init, false)
+			p.clauseStmt(s.Init)
 			p.print(token.SEMICOLON)
 		}
 		p.print(blank)
@@ -1190,6 +1351,10 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 			p.print(token.DEFAULT)
 		}
 		p.print(s.Colon, token.COLON)
+		if len(s.Body) == 1 {
+			// an indented body is printed without braces
+			_, p.noBrace = s.Body[0].(*ast.BlockStmt)
+		}
 		p.stmtList(s.Body, 1, nextIsRBrace)
 
 	case *ast.SelectStmt:
@@ -1205,21 +1370,30 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 	case *ast.ForStmt:
 		p.print(token.FOR)
 		p.controlClause(true, s.Init, s.Cond, s.Post)
+		n := len(p.loops)
+		p.loops = append(p.loops, loopVars(s)...)
 		p.block(s.Body, 1)
+		p.loops = p.loops[:n]
 
 	case *ast.RangeStmt:
 		p.print(token.FOR, blank)
-		p.expr(s.Key)
-		if s.Value != nil {
-			// use position of value following the comma as
-			// comma position for correct comment placement
-			p.print(s.Value.Pos(), token.COMMA, blank)
-			p.expr(s.Value)
-		}
-		p.print(blank, s.TokPos, s.Tok, blank, token.RANGE, blank)
+		if s.Key != nil {
+			p.expr(s.Key)
+			if s.Value != nil {
+				// use position of value following the comma as
+				// comma position for correct comment placement
+				p.print(s.Value.Pos(), token.COMMA, blank)
+				p.expr(s.Value)
+			}
+			p.print(blank, s.TokPos, s.Tok, blank)
+		}
+		p.print(token.RANGE, blank)
 		p.expr(stripParens(s.X))
 		p.print(blank)
+		n := len(p.loops)
+		p.loops = append(p.loops, loopVars(s)...)
 		p.block(s.Body, 1)
+		p.loops = p.loops[:n]
 
 	default:
 		panic("unreachable")
@@ -1328,7 +1502,10 @@ func (p *printer) spec(spec ast.Spec, n int, doIndent bool) {
 	switch s := spec.(type) {
 	case *ast.ImportSpec:
 		p.setComment(s.Doc)
-		if s.Name != nil {
+		if p.blankImports[s] {
+			p.expr(ast.NewIdent("_"))
+			p.print(blank)
+		} else if s.Name != nil {
 			p.expr(s.Name)
 			p.print(blank)
 		}
@@ -1355,11 +1532,17 @@ func (p *printer) spec(spec ast.Spec, n int, doIndent bool) {
 	case *ast.TypeSpec:
 		p.setComment(s.Doc)
 		p.expr(s.Name)
+		if s.TypeParams != nil {
+			p.parameters(s.TypeParams, typeTParam)
+		}
 		if n == 1 {
 			p.print(blank)
 		} else {
 			p.print(vtab)
 		}
+		if s.Assign.IsValid() {
+			p.print(token.ASSIGN, blank)
+		}
 		p.expr(s.Type)
 		p.setComment(s.Comment)
 
@@ -1369,6 +1552,10 @@ func (p *printer) spec(spec ast.Spec, n int, doIndent bool) {
 }
 
 func (p *printer) genDecl(d *ast.GenDecl) {
+	if d == p.importDecl {
+		p.importGroup(d)
+		return
+	}
 	p.setComment(d.Doc)
 	p.print(d.Pos(), d.Tok, blank)
 
@@ -1520,12 +1707,17 @@ func (p *printer) funcDecl(d *ast.FuncDecl) {
 	p.setComment(d.Doc)
 	p.print(d.Pos(), token.FUNC, blank)
 	if d.Recv != nil {
-		p.parameters(d.Recv) // method: print receiver
+		p.parameters(d.Recv, funcParam) // method: print receiver
 		p.print(blank)
 	}
 	p.expr(d.Name)
+	if d.Type.TypeParams != nil {
+		p.parameters(d.Type.TypeParams, funcTParam)
+	}
 	p.signature(d.Type.Params, d.Type.Results)
+	p.fname, p.results = funcName(d), d.Type.Results
 	p.adjBlock(p.distanceFrom(d.Pos()), vtab, d.Body)
+	p.fname, p.results = "", nil
 }
 
 func (p *printer) decl(decl ast.Decl) {
@@ -1533,9 +1725,21 @@ func (p *printer) decl(decl ast.Decl) {
 	case *ast.BadDecl:
 		p.print(d.Pos(), "BadDecl")
 	case *ast.GenDecl:
-		p.genDecl(d)
+		if hasImplements(d) {
+			p.implementsDecl(d)
+		} else {
+			p.genDecl(d)
+		}
 	case *ast.FuncDecl:
 		p.funcDecl(d)
+	case *ast.MacroDecl:
+		// expanded where invoked
+	case *ast.MethodsDecl:
+		p.methodsDecl(d)
+	case *ast.EnumDecl:
+		p.enumDecl(d)
+	case *ast.VerbatimDecl:
+		p.verbatimDecl(d)
 	default:
 		panic("unreachable")
 	}
@@ -1549,7 +1753,10 @@ func declToken(decl ast.Decl) (tok token.Token) {
 	switch d := decl.(type) {
 	case *ast.GenDecl:
 		tok = d.Tok
-	case *ast.FuncDecl:
+		if types, impls := splitImplements(d); len(types) == 0 && len(impls) > 0 {
+			tok = token.VAR // printed as var declarations
+		}
+	case *ast.FuncDecl, *ast.MethodsDecl:
 		tok = token.FUNC
 	}
 	return
@@ -1558,6 +1765,10 @@ func declToken(decl ast.Decl) (tok token.Token) {
 func (p *printer) declList(list []ast.Decl) {
 	tok := token.ILLEGAL
 	for _, d := range list {
+		if _, isMacro := d.(*ast.MacroDecl); isMacro {
+			// expanded where invoked
+			continue
+		}
 		prev := tok
 		tok = declToken(d)
 		// If the declaration token changed (e.g., from CONST to TYPE)
@@ -1584,6 +1795,9 @@ func (p *printer) file(src *ast.File) {
 	p.setComment(src.Doc)
 	p.print(src.Pos(), token.PACKAGE, blank)
 	p.expr(src.Name)
+	p.pkgName = src.Name.Name
+	p.declareMacros(src)
+	p.autoImports(src)
 	p.declList(src.Decls)
 	p.print(newline)
 }
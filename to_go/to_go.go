@@ -15,6 +15,7 @@ import (
 	"unicode"
 
 	"github.com/DAddYE/igo/ast"
+	"github.com/DAddYE/igo/scanner"
 	"github.com/DAddYE/igo/token"
 )
 
@@ -59,6 +60,24 @@ type printer struct {
 	wsbuf       []whiteSpace // delayed white space
 	noBrace     bool         // in certains scenarios (read case/default) we don't want a {} closure.
 
+	// Lowering of iGo constructs
+	imports    map[string]string // import path -> package name; "" if dot-imported
+	missing    []string          // import paths of the needed packages not imported
+	importDecl *ast.GenDecl      // import declaration the missing ones merge into; or nil
+	pkgName    string            // package name
+	pkgPath    string            // package import path, once looked up; or ""
+	fname      string            // name of the function being printed; or ""
+	results    *ast.FieldList    // results of the function being printed; or nil
+	tries      int               // number of try expressions lowered so far
+	loops      []*ast.Object     // variables of the loops around the statement being printed
+
+	// Expansion of macros
+	macros       map[string]*macroDef     // macros visible in the file being printed
+	blankImports map[*ast.ImportSpec]bool // imports only referred to by macros
+	expansions   int                      // number of macro expansions so far
+	macroDepth   int                      // nesting depth of the macro being expanded
+	errors       scanner.ErrorList        // expansion and lowering errors
+
 	// Positions
 	// The out position differs from the pos position when the result
 	// formatting differs from the source formatting (in the amount of
@@ -430,6 +449,43 @@ func trimRight(s string) string {
 	return strings.TrimRightFunc(s, unicode.IsSpace)
 }
 
+// isBlockComment reports whether c is a #[-style comment ]#.
+func isBlockComment(c *ast.Comment) bool {
+	return strings.HasPrefix(c.Text, "#[")
+}
+
+// unindentLines removes from all but the first line of a block comment
+// the white space prefix common to the non-blank ones, ignoring a last
+// line holding only the closing marker, but no more than the first
+// column bytes, the indentation of the line the comment starts on. The
+// lines keep their indentation relative to that line, and the printer
+// adds back its own when writing them.
+//
+func unindentLines(lines []string, column int) {
+	last := len(lines) - 1
+	if last > 0 && strings.TrimSpace(lines[last]) == "*/" {
+		lines[last] = "*/"
+	}
+	prefix, first := "", true
+	for _, line := range lines[1:] {
+		if isBlank(line) || line == "*/" {
+			continue
+		}
+		ws := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix, first = ws, false
+		} else {
+			prefix = commonPrefix(prefix, ws)
+		}
+	}
+	if column >= 0 && len(prefix) > column {
+		prefix = prefix[:column]
+	}
+	for i, line := range lines[1:] {
+		lines[1+i] = strings.TrimPrefix(line, prefix)
+	}
+}
+
 func (p *printer) writeComment(comment *ast.Comment, prefix string) {
 	text := comment.Text
 	pos := p.posFor(comment.Pos())
@@ -456,6 +512,25 @@ func (p *printer) writeComment(comment *ast.Comment, prefix string) {
 		}
 	}
 
+	if isBlockComment(comment) {
+		// #[-style comments are printed as /*-style comments, line by
+		// line, letting the write function take care of the indentation
+		t := strings.TrimSuffix(text[2:], "]#")
+		t = ast.ShiftEscapes(ast.ShiftEscapes(t, '*', '/', 1), ']', '#', -1)
+		lines := strings.Split("/*"+t+"*/", "\n")
+		unindentLines(lines, pos.Column-1)
+		for i, line := range lines {
+			if i > 0 {
+				p.writeByte('\f', 1)
+				pos = p.pos
+			}
+			if len(line) > 0 {
+				p.writeString(pos, trimRight(line), true)
+			}
+		}
+		return
+	}
+
 	t := trimRight(text[1:])
 
 	// shortcut common case of //-style comments
@@ -463,7 +538,7 @@ func (p *printer) writeComment(comment *ast.Comment, prefix string) {
 	if prefix != "//" {
 		suffix = " */ "
 		// Since the */ thing is allowed in # comments, we should escape it.
-		t = strings.Replace(t, "*/", `*\/`, -1) + " "
+		t = ast.ShiftEscapes(t, '*', '/', 1) + " "
 		prefix = " " + prefix
 	}
 
@@ -520,9 +595,13 @@ func (p *printer) intersperseComments(next token.Position, tok token.Token) (wro
 	var last *ast.Comment
 	for p.commentBefore(next) {
 		for _, c := range p.comment.List {
-			if tok == token.LPAREN || tok == token.LBRACE {
+			switch {
+			case isBlockComment(c):
+				p.writeCommentPrefix(p.posFor(c.Pos()), next, last, c, tok)
 				p.writeComment(c, "/*")
-			} else {
+			case tok == token.LPAREN || tok == token.LBRACE:
+				p.writeComment(c, "/*")
+			default:
 				p.writeCommentPrefix(p.posFor(c.Pos()), next, last, c, tok)
 				p.writeComment(c, "//")
 			}
@@ -532,6 +611,21 @@ func (p *printer) intersperseComments(next token.Position, tok token.Token) (wro
 	}
 
 	if last != nil {
+		if isBlockComment(last) {
+			// if the next item follows on the same line and is not
+			// a comma or a closing token, separate it with a blank
+			if p.lineFor(last.End()) == next.Line && tok != token.COMMA &&
+				tok != token.RPAREN && tok != token.RBRACK && tok != token.RBRACE {
+				p.writeByte(' ', 1)
+			}
+			// ensure that there is a line break before a closing '}'
+			// unless explicitly disabled, or at eof
+			needsLinebreak :=
+				tok == token.RBRACE && p.mode&noExtraLinebreak == 0 ||
+					tok == token.EOF
+			return p.writeCommentSuffix(needsLinebreak)
+		}
+
 		// ensure that there is a line break after a //-style comment,
 		// before a closing '}' ')' unless explicitly disabled, or at eof
 		needsLinebreak :=
@@ -639,6 +733,7 @@ func (p *printer) print(args ...interface{}) {
 		// information about the current arg
 		var data string
 		var isLit bool
+		var src string       // source text of data, if different
 		var impliedSemi bool // value for p.impliedSemi after this arg
 
 		switch x := arg.(type) {
@@ -676,11 +771,20 @@ func (p *printer) print(args ...interface{}) {
 
 		case *ast.Ident:
 			data = x.Name
+			if strings.HasPrefix(data, "@") {
+				// escaped identifier
+				src = data
+				data = data[1:]
+			}
 			impliedSemi = true
 			p.lastTok = token.IDENT
 
 		case *ast.BasicLit:
 			data = x.Value
+			if x.Kind == token.STRING && strings.HasPrefix(data, `"""`) {
+				src = data
+				data = goString(scanner.TripleQuoted(data))
+			}
 			isLit = true
 			impliedSemi = true
 			p.lastTok = x.Kind
@@ -751,6 +855,11 @@ func (p *printer) print(args ...interface{}) {
 		}
 
 		p.writeString(next, data, isLit)
+		if src != "" {
+			// keep p.pos in sync with the source
+			p.pos.Offset += len(src) - len(data)
+			p.pos.Line += strings.Count(src, "\n") - strings.Count(data, "\n")
+		}
 		p.impliedSemi = impliedSemi
 	}
 }
@@ -837,8 +946,8 @@ func (p *printer) printNode(node interface{}) error {
 			p.comments = comments[i:j]
 		}
 	} else if n, ok := node.(*ast.File); ok {
-		// use ast.File comments, if any
-		p.comments = n.Comments
+		// use ast.File comments, if any, but those of macro declarations
+		p.comments = p.macroFreeComments(n)
 	}
 
 	// if there are no comments, use node comments
@@ -999,6 +1108,7 @@ const (
 	TabIndent                  // use tabs for indentation independent of UseSpaces
 	UseSpaces                  // use spaces instead of tabs for alignment
 	SourcePos                  // emit //line comments to preserve original source positions
+	ImportStd                  // import the standard packages referred to but not imported
 )
 
 // A Config node controls the output of Fprint.
@@ -1006,6 +1116,11 @@ type Config struct {
 	Mode     Mode // default: 0
 	Tabwidth int  // default: 8
 	Indent   int  // default: 0 (all code is indented at least by this much)
+
+	// PkgFiles are the other files of the package of the printed file,
+	// whose macros may be invoked in the printed file, and whose functions
+	// are checked when called with try.
+	PkgFiles []*ast.File
 }
 
 // fprint implements Fprint and takes a nodesSizes map for setting up the printer state.
@@ -1017,6 +1132,9 @@ func (cfg *Config) fprint(output io.Writer, fset *token.FileSet, node interface{
 	if err = p.printNode(node); err != nil {
 		return
 	}
+	if err = p.errors.Err(); err != nil {
+		return
+	}
 	// print outstanding comments
 	p.impliedSemi = false // EOF acts like a newline
 	p.flush(token.Position{Offset: infinity, Line: infinity}, token.EOF)
@@ -0,0 +1,783 @@
+package to_go_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DAddYE/igo/parser"
+	"github.com/DAddYE/igo/to_go"
+	"github.com/DAddYE/igo/token"
+)
+
+// compiles holds iGo sources and the Go source they compile to.
+var compiles = []struct {
+	name string
+	src  string
+	want string
+}{
+	{"block comment markers", `package p
+
+#[ a */ b ]\# c *\/ d ]#
+var x = 1
+`, `package p
+
+/* a *\/ b ]# c *\\/ d */
+var x = 1
+`},
+	{"struct field comments", `package p
+
+type S struct # S
+# Mention field.
+	a int
+`, `package p
+
+type S struct { // S
+	// Mention field.
+	a int
+}
+`},
+	{"interface method comments", `package p
+
+type I interface
+# Method.
+	M()
+`, `package p
+
+type I interface {
+	// Method.
+	M()
+}
+`},
+	{"interpolated formats", `package p
+
+import "fmt"
+
+macro wrap(err expr, what expr)
+	if err != nil
+		return fmt.Errorf("#{what}: %w", err)
+
+func f(name string, n int, err error) error
+	wrap!(err, name)
+	fmt.Printf("#{name} 100%%\n")
+	fmt.Printf("%d of #{n:%d}: %*s #{name}\n", 1, 2, "x")
+	fmt.Printf("#{n:%d}")
+	return nil
+`, `package p
+
+import "fmt"
+
+func f(name string, n int, err error) error {
+	if err != nil {
+		return fmt.Errorf("%v: %w", name, err)
+	}
+	fmt.Printf("%v 100%%\n", name)
+	fmt.Printf("%d of %d: %*s %v\n", 1, n, 2, "x", name)
+	fmt.Printf("%d", n)
+	return nil
+}
+`},
+	{"interpolation operands", `package p
+
+import
+	"os"
+
+	"github.com/x/y"
+
+func f(err error, r rune, u uint64, name string) string
+	_, _ = os.Args, y.Z
+	a := "err: #{err:%s} #{r:%q} #{u:%d} #{name:%s}"
+	b := "#{string(r):%s} #{7:%d} #{true:%t} #{"x":%q}"
+	return a + b
+`, `package p
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/x/y"
+)
+
+func f(err error, r rune, u uint64, name string) string {
+	_, _ = os.Args, y.Z
+	a := fmt.Sprintf("err: %s %q %d %s", err, r, u, name)
+	b := string(r) + " " + strconv.FormatInt(int64(7), 10) + " " + strconv.FormatBool(true) + " " + strconv.Quote("x")
+	return a + b
+}
+`},
+	{"merged imports", `package p
+
+import "os"
+
+var s = "#{len(os.Args):%d}"
+`, `package p
+
+import (
+	"fmt"
+	"os"
+)
+
+var s = fmt.Sprintf("%d", len(os.Args))
+`},
+	{"try statement", `package p
+
+func pair() (int, string, error)
+	return 0, "", nil
+
+func f() error
+	try pair()
+	return nil
+`, `package p
+
+func pair() (int, string, error) {
+	return 0, "", nil
+}
+
+func f() error {
+	if _, _, err_try1 := pair(); err_try1 != nil {
+		return err_try1
+	}
+	return nil
+}
+`},
+	{"directives", `#go:build linux
+
+package p
+
+import "embed"
+
+# #include <stdio.h>
+import "C"
+
+#go:embed a.txt
+var fs embed.FS
+`, `//go:build linux
+
+package p
+
+import "embed"
+
+// #include <stdio.h>
+import "C"
+
+//go:embed a.txt
+var fs embed.FS
+`},
+	{"enum aliases", `package p
+
+enum Level
+	Debug = 1
+	Info = 1
+	Warn
+	Default = Warn
+	Fatal = 1 << 3
+	Panic = 8
+`, `package p
+
+import "fmt"
+
+type Level int
+
+const (
+	Debug   Level = 1
+	Info    Level = 1
+	Warn    Level = iota
+	Default Level = Warn
+	Fatal   Level = 1 << 3
+	Panic   Level = 8
+)
+
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "Debug"
+	case Warn:
+		return "Warn"
+	case Fatal:
+		return "Fatal"
+	}
+	return fmt.Sprintf("Level(%d)", l)
+}
+
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "Debug":
+		return Debug, nil
+	case "Info":
+		return Info, nil
+	case "Warn":
+		return Warn, nil
+	case "Default":
+		return Default, nil
+	case "Fatal":
+		return Fatal, nil
+	case "Panic":
+		return Panic, nil
+	}
+	return 0, fmt.Errorf("invalid Level %q", s)
+}
+
+func LevelValues() []Level {
+	return []Level{Debug, Warn, Fatal}
+}
+`},
+	{"triple-quoted strings", `package p
+
+var s = """
+	run ` + "`ls`" + `
+	  done\n
+	"""
+
+var t = """
+	  a
+	b
+	"""
+`, `package p
+
+var s = "run ` + "`ls`" + `\n  done\\n"
+
+var t = ` + "`" + `  a
+b` + "`" + `
+`},
+	{"postfix conditionals", `package p
+
+func f(xs []int, err error) error
+	return err if err != nil
+	for _, x := range xs
+		continue unless x > 0
+		use(x)
+	return nil
+`, `package p
+
+func f(xs []int, err error) error {
+	if err != nil {
+		return err
+	}
+	for _, x := range xs {
+		if !(x > 0) {
+			continue
+		}
+		use(x)
+	}
+	return nil
+}
+`},
+	{"macro parameters in indented bodies", `package p
+
+macro swap(a expr, b expr)
+	tmp := a
+	a = b
+	b = tmp
+
+func f(tmp, y int) int
+	if tmp > 0
+		swap!(tmp, y)
+	return tmp
+`, `package p
+
+func f(tmp, y int) int {
+	if tmp > 0 {
+		tmp_swap1 := tmp
+		tmp = y
+		y = tmp_swap1
+	}
+	return tmp
+}
+`},
+	{"try assigning unknown results", `package p
+
+import "os"
+
+func f(p string) ([]byte, error)
+	b := try os.ReadFile(p)
+	_ = try os.ReadFile(p)
+	return b, nil
+`, `package p
+
+import "os"
+
+func f(p string) ([]byte, error) {
+	b, err_try1 := os.ReadFile(p)
+	if err_try1 != nil {
+		return nil, err_try1
+	}
+	var err_try2 error
+	_, err_try2 = os.ReadFile(p)
+	if err_try2 != nil {
+		return nil, err_try2
+	}
+	return b, nil
+}
+`},
+	{"embed directives", `package p
+
+import "embed"
+
+#go:embed d.txt
+var b []byte
+`, `package p
+
+import _ "embed"
+
+//go:embed d.txt
+var b []byte
+`},
+	{"cgo preamble", `package p
+
+# #include <stdio.h>
+import "C"
+
+var s = "#{C.int(1)}"
+`, `package p
+
+import "fmt"
+
+// #include <stdio.h>
+import "C"
+
+var s = fmt.Sprintf("%v", C.int(1))
+`},
+	{"escaped keywords", `package p
+
+type T struct
+	@do int
+
+func f(t T) int
+	@do := t.@do
+	return @do
+`, `package p
+
+type T struct {
+	do int
+}
+
+func f(t T) int {
+	do := t.do
+	return do
+}
+`},
+	{"loop variables in go and defer bodies", `package p
+
+func f(n int)
+	for i := 0; i < n; i++
+		go
+			use(i)
+		i++
+	for _, x := range []int{1}
+		defer: use(x)
+`, `package p
+
+func f(n int) {
+	for i := 0; i < n; i++ {
+		{
+			i := i
+			go func() {
+				use(i)
+			}()
+		}
+		i++
+	}
+	for _, x := range []int{1} {
+		{
+			x := x
+			defer func() { use(x) }()
+		}
+	}
+}
+`},
+	{"methods blocks", `package p
+
+type Server struct
+	addr string
+
+methods (s *Server)
+	func Addr() string
+		return s.addr
+
+	func SetAddr(addr string): s.addr = addr
+`, `package p
+
+type Server struct {
+	addr string
+}
+
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+func (s *Server) SetAddr(addr string) { s.addr = addr }
+`},
+	{"implements declarations", `package p
+
+import
+	"io"
+	"net/http"
+
+type Server struct
+
+type Server implements http.Handler, io.Closer
+`, `package p
+
+import (
+	"io"
+	"net/http"
+)
+
+type Server struct{}
+
+var _ http.Handler = (*Server)(nil)
+var _ io.Closer = (*Server)(nil)
+`},
+	{"comprehension range kinds", `package p
+
+import "iter"
+
+type User struct
+	Name   string
+	Active bool
+
+func Pairs(yield func(string, int) bool):
+
+func f(users []User, m map[string]int, s string, ch chan int, n int, seq iter.Seq[int])
+	a := [u.Name for u in users if u.Active]
+	b := [k for k in m]
+	c := [r for r in s]
+	d := [x for x in ch]
+	e := [i * 2 for i in n]
+	g := [x for x in seq]
+	h := {k: v for k, v in Pairs}
+	use(a, b, c, d, e, g, h)
+`, `package p
+
+import "iter"
+
+type User struct {
+	Name   string
+	Active bool
+}
+
+func Pairs(yield func(string, int) bool) {}
+
+func f(users []User, m map[string]int, s string, ch chan int, n int, seq iter.Seq[int]) {
+	a := func() []string {
+		r := make([]string, 0, len(users))
+		for _, u := range users {
+			if u.Active {
+				r = append(r, u.Name)
+			}
+		}
+		return r
+	}()
+	b := func() []string {
+		r := make([]string, 0, len(m))
+		for k := range m {
+			r = append(r, k)
+		}
+		return r
+	}()
+	c := func() []rune {
+		r_ := make([]rune, 0, len(s))
+		for _, r := range s {
+			r_ = append(r_, r)
+		}
+		return r_
+	}()
+	d := func() []int {
+		r := make([]int, 0)
+		for x := range ch {
+			r = append(r, x)
+		}
+		return r
+	}()
+	e := func() []int {
+		r := make([]int, 0)
+		for i := range n {
+			r = append(r, i*2)
+		}
+		return r
+	}()
+	g := func() []int {
+		r := make([]int, 0)
+		for x := range seq {
+			r = append(r, x)
+		}
+		return r
+	}()
+	h := func() map[string]int {
+		r := make(map[string]int)
+		for k, v := range Pairs {
+			r[k] = v
+		}
+		return r
+	}()
+	use(a, b, c, d, e, g, h)
+}
+`},
+	{"comprehension types", `package p
+
+import "fmt"
+
+func f(xs []int, groups map[string][]int)
+	a := []string{fmt.Sprint(x) for x in xs}
+	b := {k: len(v) for k, v in groups}
+	c := [float64(x) / 2 for x in xs]
+	d := [v for k, v in groups if len(v) > 0]
+	use(a, b, c, d)
+`, `package p
+
+import "fmt"
+
+func f(xs []int, groups map[string][]int) {
+	a := func() []string {
+		r := make([]string, 0, len(xs))
+		for _, x := range xs {
+			r = append(r, fmt.Sprint(x))
+		}
+		return r
+	}()
+	b := func() map[string]int {
+		r := make(map[string]int, len(groups))
+		for k, v := range groups {
+			r[k] = len(v)
+		}
+		return r
+	}()
+	c := func() []float64 {
+		r := make([]float64, 0, len(xs))
+		for _, x := range xs {
+			r = append(r, float64(x)/2)
+		}
+		return r
+	}()
+	d := func() [][]int {
+		r := make([][]int, 0, len(groups))
+		for _, v := range groups {
+			if len(v) > 0 {
+				r = append(r, v)
+			}
+		}
+		return r
+	}()
+	use(a, b, c, d)
+}
+`},
+	{"conditional expressions", `package p
+
+func f(c, d bool, x int) int
+	a := 1 if c else 2
+	var s string = "a" if c else "b" if d else "c"
+	use(a, s)
+	use(x * 2 if c else 0)
+	if c
+		x := x + 1 if d else 0
+		use(x)
+	return x if c else -x
+`, `package p
+
+func f(c, d bool, x int) int {
+	var a int
+	if c {
+		a = 1
+	} else {
+		a = 2
+	}
+	var s string
+	if c {
+		s = "a"
+	} else if d {
+		s = "b"
+	} else {
+		s = "c"
+	}
+	use(a, s)
+	use(func() int {
+		if c {
+			return x * 2
+		}
+		return 0
+	}())
+	if c {
+		x := func() int {
+			if d {
+				return x + 1
+			}
+			return 0
+		}()
+		use(x)
+	}
+	if c {
+		return x
+	} else {
+		return -x
+	}
+}
+`},
+	{"indented composite literals", `package p
+
+var defaults = Config
+	Name: "default"
+	Origin: Point
+		X: 1
+		Y: 2
+	Limits: map[string]Limit
+		"cpu":
+			Max: 2
+
+var grid = [][]int
+	{1, 2}
+	{3, 4}
+`, `package p
+
+var defaults = Config{
+	Name: "default",
+	Origin: Point{
+		X: 1,
+		Y: 2,
+	},
+	Limits: map[string]Limit{
+		"cpu": {
+			Max: 2,
+		},
+	},
+}
+
+var grid = [][]int{
+	{1, 2},
+	{3, 4},
+}
+`},
+}
+
+// compile compiles the iGo source src, read from filename, to Go.
+func compile(filename, src string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	cfg := &to_go.Config{Mode: to_go.UseSpaces | to_go.TabIndent, Tabwidth: 8}
+	if _, err := cfg.Fprint(&buf, fset, file); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func TestCompile(t *testing.T) {
+	for _, tt := range compiles {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := compile("test.igo", tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImportStd(t *testing.T) {
+	src := `package main
+
+func main()
+	fmt.Println(strings.ToUpper("x"))
+	_ = errors.count
+`
+	want := `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func main() {
+	fmt.Println(strings.ToUpper("x"))
+	_ = errors.count
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "test.igo", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	cfg := &to_go.Config{Mode: to_go.UseSpaces | to_go.TabIndent | to_go.ImportStd, Tabwidth: 8}
+	if _, err := cfg.Fprint(&buf, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// compileErrors holds iGo sources and the error compiling them reports.
+var compileErrors = []struct {
+	name string
+	src  string
+	err  string
+}{
+	{"try discarding unknown results", `package p
+
+import "os"
+
+func f(p string) error
+	try os.ReadFile(p)
+	return nil
+`, "test.igo:6:6: cannot discard the results of try with a function not declared in the package: assign them"},
+	{"escape without identifier", `package p
+
+var x = @ 1
+`, "test.igo:3:9: expected identifier after @"},
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, tt := range compileErrors {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compile("test.igo", tt.src)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("got error %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+// pkgPaths holds go.mod files, the directory of a source below them
+// and the import path __pkg__ expands to there.
+var pkgPaths = []struct {
+	name  string
+	gomod string
+	dir   string
+	want  string
+}{
+	{"module root", "module example.com/m\n", ".", "example.com/m"},
+	{"subdirectory", "module example.com/m\n\ngo 1.21\n", "a/b", "example.com/m/a/b"},
+	{"quoted path", "// comment\nmodule \"example.com/q\" // trailing\n", "c", "example.com/q/c"},
+}
+
+func TestPkgPath(t *testing.T) {
+	for _, tt := range pkgPaths {
+		t.Run(tt.name, func(t *testing.T) {
+			root, err := ioutil.TempDir("", "igo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(root)
+			if err := ioutil.WriteFile(filepath.Join(root, "go.mod"), []byte(tt.gomod), 0644); err != nil {
+				t.Fatal(err)
+			}
+			filename := filepath.Join(root, tt.dir, "x.igo")
+			got, err := compile(filename, "package x\n\nvar p = __pkg__\n")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "var p = \"" + tt.want + "\""; !strings.Contains(string(got), want) {
+				t.Errorf("got:\n%s\nwant: %s", got, want)
+			}
+		})
+	}
+}
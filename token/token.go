@@ -22,6 +22,7 @@ const (
 	COMMENT
 	INDENT
 	DEDENT
+	VERBATIM // go! region of Go source
 
 	literal_beg
 	// Identifiers and basic type literals
@@ -91,6 +92,7 @@ const (
 	RBRACE    // }
 	SEMICOLON // ;
 	COLON     // :
+	TILDE     // ~
 	operator_end
 
 	keyword_beg
@@ -104,6 +106,7 @@ const (
 	DEFAULT
 	DEFER
 	ELSE
+	ENUM
 	FALLTHROUGH
 	FOR
 
@@ -112,10 +115,13 @@ const (
 	GOTO
 	IF
 	DO
+	IMPLEMENTS
 	IMPORT
 
 	INTERFACE
+	MACRO
 	MAP
+	METHODS
 	PACKAGE
 	RANGE
 	RETURN
@@ -123,7 +129,9 @@ const (
 	SELECT
 	STRUCT
 	SWITCH
+	TRY
 	TYPE
+	UNLESS
 	VAR
 	keyword_end
 )
@@ -136,6 +144,8 @@ var tokens = [...]string{
 	INDENT:  "INDENT",
 	DEDENT:  "DEDENT",
 
+	VERBATIM: "go!",
+
 	IDENT:  "IDENT",
 	INT:    "INT",
 	FLOAT:  "FLOAT",
@@ -198,6 +208,7 @@ var tokens = [...]string{
 	RBRACE:    "}",
 	SEMICOLON: ";",
 	COLON:     ":",
+	TILDE:     "~",
 
 	BREAK:    "break",
 	CASE:     "case",
@@ -208,18 +219,22 @@ var tokens = [...]string{
 	DEFAULT:     "default",
 	DEFER:       "defer",
 	ELSE:        "else",
+	ENUM:        "enum",
 	FALLTHROUGH: "fallthrough",
 	FOR:         "for",
 
-	FUNC:   "func",
-	GO:     "go",
-	GOTO:   "goto",
-	IF:     "if",
-	DO:     "do",
-	IMPORT: "import",
+	FUNC:       "func",
+	GO:         "go",
+	GOTO:       "goto",
+	IF:         "if",
+	DO:         "do",
+	IMPLEMENTS: "implements",
+	IMPORT:     "import",
 
 	INTERFACE: "interface",
+	MACRO:     "macro",
 	MAP:       "map",
+	METHODS:   "methods",
 	PACKAGE:   "package",
 	RANGE:     "range",
 	RETURN:    "return",
@@ -227,7 +242,9 @@ var tokens = [...]string{
 	SELECT: "select",
 	STRUCT: "struct",
 	SWITCH: "switch",
+	TRY:    "try",
 	TYPE:   "type",
+	UNLESS: "unless",
 	VAR:    "var",
 }
 